@@ -0,0 +1,242 @@
+package arkiv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Layout of the members encrypted with AES-256-GCM (formats arkiv002 and
+// arkiv003):
+//
+//	SALT (16 bytes) || CHUNK_0 || CHUNK_1 || ... || CHUNK_n
+//
+// The key is unique to the member: PBKDF2-SHA256(password, SALT, 10000
+// iterations) in arkiv002, HKDF-SHA256(master key, SALT, "arkiv003
+// member") in arkiv003, where the master key is derived once per archive
+// (see kdfMember). The plaintext is cut in chunks of aeadChunkSize
+// bytes (the last one may be shorter, and is empty only when the whole
+// plaintext is), each sealed with a 16-byte tag. The 12-byte nonce of
+// chunk i is i on 11 big-endian bytes followed by 1 for the last chunk and
+// 0 for the others, so removed, reordered or appended chunks fail to
+// authenticate. Every chunk is sealed with the name of the member as
+// additional data (see memberAD), so members swapped in the outer tar fail
+// to authenticate as well.
+const (
+	aeadSaltSize  = 16
+	aeadChunkSize = 64 << 10
+	aeadTagSize   = 16
+	aeadNonceSize = 12
+	hkdfInfo      = "arkiv003 member"
+)
+
+// gcmCipher encrypts members with the chunked AES-256-GCM stream. The key
+// of a member is derived from its salt by memberKey.
+type gcmCipher struct {
+	memberKey func(salt []byte) ([]byte, error)
+}
+
+// passwordKeys derives the key of each member from the password with
+// PBKDF2 (format arkiv002).
+func passwordKeys(password []byte) func(salt []byte) ([]byte, error) {
+	return func(salt []byte) ([]byte, error) {
+		return pbkdf2.Key(password, salt, pbkdf2Iter, keyLen, sha256.New), nil
+	}
+}
+
+// masterKeys derives the key of each member from the master key of the
+// archive with HKDF (format arkiv003), which is cheap.
+func masterKeys(master []byte) func(salt []byte) ([]byte, error) {
+	return func(salt []byte) ([]byte, error) {
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, master, salt, []byte(hkdfInfo)), key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// memberAD returns the additional data authenticated with the chunks of
+// the member name. The name of a data member is only known once its
+// content is hashed, after it is encrypted: data members all get "data/",
+// and their content is checked against their name by HASH_DATA.
+func memberAD(name string) []byte {
+	if strings.HasPrefix(name, "data/") {
+		return []byte("data/")
+	}
+	return []byte(name)
+}
+
+// encryptWriter implements memberCipher.
+func (c gcmCipher) encryptWriter(w io.Writer, name string) (io.WriteCloser, error) {
+	salt := make([]byte, aeadSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := c.newAEAD(salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &aeadWriter{w: w, aead: aead, ad: memberAD(name), buf: make([]byte, 0, aeadChunkSize)}, nil
+}
+
+// decryptReader implements memberCipher.
+func (c gcmCipher) decryptReader(r io.Reader, name string) (io.Reader, error) {
+	salt := make([]byte, aeadSaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, err
+	}
+	aead, err := c.newAEAD(salt)
+	if err != nil {
+		return nil, err
+	}
+	return &aeadReader{
+		r:     r,
+		aead:  aead,
+		ad:    memberAD(name),
+		chunk: make([]byte, aeadChunkSize+aeadTagSize+1),
+		buf:   make([]byte, 0, aeadChunkSize),
+	}, nil
+}
+
+// wellFormed implements memberCipher: a salt and at least one tag.
+func (c gcmCipher) wellFormed(size int64) bool {
+	return size >= aeadSaltSize+aeadTagSize
+}
+
+// newAEAD derives the key of a member from its salt.
+func (c gcmCipher) newAEAD(salt []byte) (cipher.AEAD, error) {
+	key, err := c.memberKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// aeadNonce returns the nonce of chunk i.
+func aeadNonce(i uint64, last bool) []byte {
+	nonce := make([]byte, aeadNonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// aeadWriter seals the plaintext written to it chunk by chunk. A full
+// chunk is only sealed when more data follows, so that Close always seals
+// the last one.
+type aeadWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	ad   []byte
+	buf  []byte
+	seq  uint64
+	out  []byte
+}
+
+// Write buffers p and seals the chunks known not to be the last.
+func (a *aeadWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(a.buf) == aeadChunkSize {
+			if err := a.seal(false); err != nil {
+				return 0, err
+			}
+		}
+		k := copy(a.buf[len(a.buf):aeadChunkSize], p)
+		a.buf = a.buf[:len(a.buf)+k]
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Close seals the last chunk.
+func (a *aeadWriter) Close() error {
+	return a.seal(true)
+}
+
+// seal writes the buffered chunk.
+func (a *aeadWriter) seal(last bool) error {
+	a.out = a.aead.Seal(a.out[:0], aeadNonce(a.seq, last), a.buf, a.ad)
+	a.seq++
+	a.buf = a.buf[:0]
+	_, err := a.w.Write(a.out)
+	return err
+}
+
+// aeadReader opens the chunks of an AES-256-GCM stream. It reads one byte
+// past each chunk to know whether it is the last one.
+type aeadReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	ad    []byte
+	chunk []byte // sealed chunk, plus one look-ahead byte
+	ahead int    // look-ahead bytes already at the start of chunk
+	seq   uint64
+	buf   []byte // plaintext of the current chunk
+	plain []byte // part of buf not read yet
+	done  bool
+}
+
+// Read returns authenticated plaintext only.
+func (a *aeadReader) Read(p []byte) (int, error) {
+	for len(a.plain) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, a.plain)
+	a.plain = a.plain[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next chunk.
+func (a *aeadReader) open() error {
+	n, err := io.ReadFull(a.r, a.chunk[a.ahead:])
+	n += a.ahead
+	a.ahead = 0
+	switch {
+	case err == nil:
+		// A byte follows: this chunk is full and not the last.
+		n--
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		a.done = true
+	default:
+		return err
+	}
+	if n < aeadTagSize || (a.done && n == aeadTagSize && a.seq > 0) {
+		return io.ErrUnexpectedEOF
+	}
+	plain, err := a.aead.Open(a.buf[:0], aeadNonce(a.seq, a.done), a.chunk[:n], a.ad)
+	if err != nil {
+		return ErrAuthFailed
+	}
+	a.seq++
+	a.plain = plain
+	if !a.done {
+		// Keep the look-ahead byte for the next chunk.
+		a.chunk[0] = a.chunk[n]
+		a.ahead = 1
+	}
+	return nil
+}
+
@@ -0,0 +1,237 @@
+package arkiv
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// baseMember is the member of an incremental archive recording its base
+// archive. It follows prefix.zst.aes and holds "key=value" lines:
+//
+//	path=RELATIVE/OR/ABSOLUTE/PATH.arkiv
+//	id=ARCHIVE_ID
+//
+// A relative path is resolved from the directory of the incremental
+// archive. An incremental archive shares the prefix of its base, so equal
+// contents have the same HASH_DATA, and omits the data members found in
+// the chain of bases.
+const baseMember = "base.zst.aes"
+
+// baseInfo identifies the base archive of an incremental archive.
+type baseInfo struct {
+	path string
+	id   string
+}
+
+// encodeBaseInfo serializes the content of base.zst.aes.
+func encodeBaseInfo(b baseInfo) []byte {
+	return []byte("path=" + b.path + "\nid=" + b.id + "\n")
+}
+
+// decodeBaseInfo parses the content of base.zst.aes. Unknown keys are
+// ignored.
+func decodeBaseInfo(data []byte) (*baseInfo, error) {
+	b := &baseInfo{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		switch {
+		case !ok:
+			continue
+		case key == "path":
+			b.path = value
+		case key == "id":
+			b.id = value
+		}
+	}
+	if b.path == "" || b.id == "" {
+		return nil, fmt.Errorf("%w: incomplete %s", ErrBadBase, baseMember)
+	}
+	return b, nil
+}
+
+// readBaseInfo decrypts and parses the base member m of the archive f.
+func readBaseInfo(f *os.File, m member, c memberCipher) (*baseInfo, error) {
+	dr, err := c.decryptReader(memberReader(f, m), m.name)
+	if err != nil {
+		return nil, err
+	}
+	zdec, err := NewZstdDecoder(dr)
+	if err != nil {
+		return nil, err
+	}
+	defer zdec.Close()
+	data, err := io.ReadAll(zdec)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBaseInfo(data)
+}
+
+// ID returns the identity of the archive: the hex SHA-512/256 of its
+// encrypted index member. As the encryption is salted, it differs for
+// every archive written, even from the same files.
+func (a *ArchiveReader) ID() (string, error) {
+	f, members, err := a.openMembers()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	m, ok := members.lookup("index.zst.aes")
+	if !ok {
+		return "", ErrMissingIndex
+	}
+	h := sha512.New512_256()
+	if _, err := io.Copy(h, memberReader(f, m)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BasePath returns the path of the base archive of an incremental
+// archive, or an empty string for a full archive.
+func (a *ArchiveReader) BasePath() (string, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return "", err
+	}
+	if a.base == nil {
+		return "", nil
+	}
+	return a.resolveBasePath(), nil
+}
+
+// resolveBasePath returns the recorded base path, resolved from the
+// directory of the archive when it is relative.
+func (a *ArchiveReader) resolveBasePath() string {
+	if filepath.IsAbs(a.base.path) {
+		return a.base.path
+	}
+	return filepath.Join(filepath.Dir(a.path), filepath.FromSlash(a.base.path))
+}
+
+// parent opens the base archive of an incremental archive, with the same
+// password and options, and checks that it is the one recorded. It
+// returns nil for a full archive. The reader is kept for the session.
+func (a *ArchiveReader) parent() (*ArchiveReader, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if a.base == nil {
+		return nil, nil
+	}
+	a.baseMu.Lock()
+	defer a.baseMu.Unlock()
+	if a.parentReader != nil {
+		return a.parentReader, nil
+	}
+	path := a.resolveBasePath()
+	p := NewArchiveReaderWithOptions(path, append([]byte(nil), a.password...), a.opts)
+	id, err := p.ID()
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("%w %s: %w", ErrBadBase, path, err)
+	}
+	if id != a.base.id {
+		p.Close()
+		return nil, fmt.Errorf("%w %s: not the archive this one was built on", ErrBadBase, path)
+	}
+	if p.prefixB64 != a.prefixB64 {
+		p.Close()
+		return nil, fmt.Errorf("%w %s: different prefix", ErrBadBase, path)
+	}
+	if p.format.Hash != a.format.Hash {
+		p.Close()
+		return nil, fmt.Errorf("%w %s: different hash", ErrBadBase, path)
+	}
+	a.parentReader = p
+	return p, nil
+}
+
+// chainHasData reports whether a data member called name is stored in
+// one of the base archives of a.
+func (a *ArchiveReader) chainHasData(name string) (bool, error) {
+	for cur := a; ; {
+		p, err := cur.parent()
+		if err != nil || p == nil {
+			return false, err
+		}
+		if _, ok := p.members.lookup(name); ok {
+			return true, nil
+		}
+		cur = p
+	}
+}
+
+// openBase loads the base archive of an incremental write session: it
+// returns the raw prefix to share with it and records, in baseData, the
+// HASH_DATA of every content stored in its chain. It must be called
+// before the new archive file is created, as it may be the same path.
+func (w *ArchiveWriter) openBase() ([]byte, *baseInfo, error) {
+	r := NewArchiveReader(w.opts.Base, append([]byte(nil), w.password...))
+	defer r.Close()
+	id, err := r.ID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Contents are shared by HASH_DATA: both formats must hash alike.
+	if r.format.Hash != w.format.Hash {
+		return nil, nil, fmt.Errorf("%w: %s hashes with %s, not %s", ErrBadBase, w.opts.Base, r.format.Hash, w.format.Hash)
+	}
+
+	// Refuse to overwrite the base with its own increment.
+	if bi, err := os.Stat(w.opts.Base); err == nil {
+		if oi, err := os.Stat(w.path); err == nil && os.SameFile(bi, oi) {
+			return nil, nil, fmt.Errorf("%w: %s is the archive being written", ErrBadBase, w.opts.Base)
+		}
+	}
+
+	// Collect the contents stored along the chain.
+	w.baseData = make(map[string]bool)
+	for cur := r; cur != nil; {
+		for _, m := range cur.members.members {
+			if hData, ok := strings.CutPrefix(m.name, "data/"); ok && hData != "" {
+				w.baseData[strings.TrimSuffix(hData, ".zst.aes")] = true
+			}
+		}
+		if cur, err = cur.parent(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	path, err := relativeBasePath(w.opts.Base, w.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefixRaw, err := base64.StdEncoding.DecodeString(r.prefixB64)
+	if err != nil {
+		return nil, nil, err
+	}
+	return prefixRaw, &baseInfo{path: path, id: id}, nil
+}
+
+// relativeBasePath returns the path to record in base.zst.aes for the base
+// archive base of archive: relative to the directory of archive when
+// possible, absolute otherwise.
+func relativeBasePath(base, archive string) (string, error) {
+	path := base
+	absBase, err1 := filepath.Abs(base)
+	absDir, err2 := filepath.Abs(filepath.Dir(archive))
+	if err1 == nil && err2 == nil {
+		if rel, err := filepath.Rel(absDir, absBase); err == nil {
+			path = filepath.ToSlash(rel)
+		} else {
+			path = absBase
+		}
+	}
+	if strings.ContainsAny(path, "\n") {
+		return "", fmt.Errorf("%w: invalid path %q", ErrBadBase, path)
+	}
+	return path, nil
+}
+
@@ -0,0 +1,61 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// OpenFile returns the content of the regular file stored at path, either
+// as written in the index (escaped, as printed by List) or unescaped. Only
+// its data member is decrypted and decompressed. Directories, symlinks and
+// FIFOs yield ErrNotRegular, unknown paths fs.ErrNotExist. The content is
+// checked against its HASH_DATA: the reader returns ErrHashMismatch instead
+// of io.EOF when they differ. The caller must close the returned reader.
+func (a *ArchiveReader) OpenFile(path string) (io.ReadCloser, error) {
+	// Ensure prefix and index are ready.
+	if err := a.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	// Look the path up in the index.
+	e, ok := a.lookupEntry(path)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, path)
+	}
+	if e.HashData != "" {
+		return a.openData(e.HashData)
+	}
+
+	// Not a regular file: read its meta to tell what it is.
+	metas, err := a.readMetas([]IndexEntry{e})
+	if err != nil {
+		return nil, err
+	}
+	mh := metas[e.PathRaw]
+	if mh == nil {
+		return nil, fmt.Errorf("%w for %s", ErrMissingMeta, e.PathRaw)
+	}
+	kind := "special file"
+	switch mh.Typeflag {
+	case tar.TypeDir:
+		kind = "directory"
+	case tar.TypeSymlink:
+		kind = "symlink to " + mh.Linkname
+	case tar.TypeFifo:
+		kind = "FIFO"
+	}
+	return nil, fmt.Errorf("%w: %s is a %s", ErrNotRegular, e.PathRaw, kind)
+}
+
+// lookupEntry returns the index entry whose raw or unescaped path is path.
+func (a *ArchiveReader) lookupEntry(path string) (IndexEntry, bool) {
+	for _, e := range a.index.Entries {
+		if e.PathRaw == path || unescapeIndexPath(e.PathRaw) == path {
+			return e, true
+		}
+	}
+	return IndexEntry{}, false
+}
+
@@ -0,0 +1,124 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Kinds of the changes reported by Check, besides ChangeType, ChangeContent
+// and ChangeMeta.
+const (
+	// ChangeMissing: an archived path does not exist on disk.
+	ChangeMissing = "missing"
+	// ChangeExtra: a file on disk, in an archived directory, is not in
+	// the archive.
+	ChangeExtra = "extra"
+	// ChangeUnreadable: a local file could not be read; Detail holds the
+	// error.
+	ChangeUnreadable = "unreadable"
+)
+
+// Check compares the archive, for the paths matching the optional
+// prefixes, with the files under root: each archived path p is looked up
+// as root/p. Local files are classified as Create does and regular files
+// are hashed with the prefix of the archive. Files found in an archived
+// directory but absent from the archive are reported as extra (their
+// content is not walked). Local files that cannot be read are reported
+// as unreadable and the check goes on. The changes are sorted by path.
+// Modification times of symlinks are not compared, as Extract cannot
+// restore them.
+func (a *ArchiveReader) Check(root string, prefixes []string) ([]Change, error) {
+	// Load the index and the meta headers of the selected entries.
+	entries, metas, err := a.selectMetas(prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every archived path, to spot extra files.
+	archived := make(map[string]bool, len(a.index.Entries))
+	for _, e := range a.index.Entries {
+		archived[e.PathRaw] = true
+	}
+
+	var changes []Change
+	src := hostSource{}
+	for raw, e := range entries {
+		mh := metas[raw]
+		local := localPath(root, raw)
+
+		// --- Type, as create would archive the local file ---
+		fi, hdr, meta, err := describePath(src, local)
+		if errors.Is(err, fs.ErrNotExist) {
+			changes = append(changes, Change{Kind: ChangeMissing, Path: raw})
+			continue
+		}
+		if errors.Is(err, ErrUnsupportedFile) {
+			changes = append(changes, Change{Kind: ChangeType, Path: raw, Detail: fmt.Sprintf("%c -> special file", typeChar(mh))})
+			continue
+		}
+		if err != nil {
+			changes = append(changes, Change{Kind: ChangeUnreadable, Path: raw, Detail: err.Error()})
+			continue
+		}
+		if typeChar(mh) != typeChar(hdr) {
+			changes = append(changes, Change{Kind: ChangeType, Path: raw, Detail: fmt.Sprintf("%c -> %c", typeChar(mh), typeChar(hdr))})
+			continue
+		}
+
+		// --- Content ---
+		if e.HashData != "" {
+			h, err := a.localDataHash(local)
+			if err != nil {
+				changes = append(changes, Change{Kind: ChangeUnreadable, Path: raw, Detail: err.Error()})
+			} else if h != e.HashData {
+				changes = append(changes, Change{Kind: ChangeContent, Path: raw})
+			}
+		}
+
+		// --- Metadata ---
+		hdr.Mode = int64(meta.Mode.Perm())
+		hdr.Uid, hdr.Gid = meta.Uid, meta.Gid
+		hdr.ModTime = meta.ModTime
+		if hdr.Typeflag == tar.TypeSymlink {
+			hdr.ModTime = mh.ModTime
+		}
+		if detail := metaChanges(mh, hdr); detail != "" {
+			changes = append(changes, Change{Kind: ChangeMeta, Path: raw, Detail: detail})
+		}
+
+		// --- Extra files in archived directories ---
+		if !fi.IsDir() {
+			continue
+		}
+		children, err := os.ReadDir(local)
+		if err != nil {
+			changes = append(changes, Change{Kind: ChangeUnreadable, Path: raw, Detail: err.Error()})
+			continue
+		}
+		base := unescapeIndexPath(raw)
+		for _, c := range children {
+			_, childRaw := escapeForIndex(base + "/" + c.Name())
+			if !archived[childRaw] {
+				changes = append(changes, Change{Kind: ChangeExtra, Path: childRaw})
+			}
+		}
+	}
+
+	sortChanges(changes)
+	return changes, nil
+}
+
+// localDataHash returns the HASH_DATA of the content of the local file at
+// path.
+func (a *ArchiveReader) localDataHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return a.format.dataHash(a.prefixB64, f)
+}
+
@@ -0,0 +1,355 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Create writes a new Arkiv archive at writer.path using the provided
+// input file system paths. It writes members in this order:
+//   magic.zst → prefix.zst.aes → meta/* and data/* → index.zst.aes (last)
+// It strictly adheres to the Arkiv format for full compatibility. Entries
+// already added with AddFile, AddDir, ... are kept, and the archive is
+// finished when Create returns.
+func (w *ArchiveWriter) Create(inputs []string) error {
+	roots := make([]string, 0, len(inputs))
+	for _, in := range inputs {
+		roots = append(roots, filepath.Clean(in))
+	}
+	return w.fail(w.create(hostSource{}, roots))
+}
+
+// CreateFS is like Create but reads the input tree from fsys. Roots are
+// slash-separated fs.FS names (the whole file system when none is given)
+// and are stored as is in the index. Symlinks are archived when fsys
+// implements ReadLinkFS; ownership comes from the Sys() value of the file
+// information (see OwnerInfo) and defaults to 0:0.
+func (w *ArchiveWriter) CreateFS(fsys fs.FS, roots []string) error {
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	for _, r := range roots {
+		if !fs.ValidPath(r) {
+			return &fs.PathError{Op: "create", Path: r, Err: fs.ErrInvalid}
+		}
+	}
+	return w.fail(w.create(fsSource{fsys: fsys}, roots))
+}
+
+// create adds every path found under the given roots of src to the
+// archive, in C-locale byte order, then finishes it.
+func (w *ArchiveWriter) create(src source, roots []string) error {
+	// --- Walk inputs, collect paths (include directory itself, no symlink following) ---
+	paths := make([]string, 0)
+	for _, in := range roots {
+		err := src.walk(in, func(p string) error {
+			// Always include the visited path.
+			paths = append(paths, p)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Sort with C-locale byte ordering and de-duplicate exact paths.
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Compare(paths[i], paths[j]) < 0
+	})
+	uniq := make([]string, 0, len(paths))
+	var last string
+	for _, p := range paths {
+		if p == last {
+			continue
+		}
+		uniq = append(uniq, p)
+		last = p
+	}
+	paths = uniq
+
+	// --- Detect file types and attributes, in order ---
+	if err := w.begin(); err != nil {
+		return err
+	}
+	items := make([]createItem, 0, len(paths))
+	sizeCount := make(map[int64]int)
+	for _, p := range paths {
+		fi, hdr, meta, err := describePath(src, p)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			sizeCount[fi.Size()]++
+		}
+		if w.added[p] {
+			return fmt.Errorf("%w: %s", ErrDuplicatePath, p)
+		}
+		items = append(items, createItem{
+			path: p,
+			hdr:  hdr,
+			meta: meta,
+			size: fi.Size(),
+		})
+	}
+	for i := range items {
+		items[i].maybeDup = items[i].hdr.Typeflag == tar.TypeReg &&
+			(sizeCount[items[i].size] > 1 || w.storedSizes[items[i].size] || w.baseData != nil)
+	}
+
+	// --- Build meta/* and data/* members on worker goroutines ---
+	jobs := w.opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]chan *preparedItem, len(items))
+	for i := range results {
+		results[i] = make(chan *preparedItem, 1)
+	}
+	next := make(chan int)
+	tokens := make(chan struct{}, 2*jobs)
+	done := make(chan struct{})
+	claims := &dataClaims{owner: make(map[string]int)}
+
+	// Feed item numbers in order; the tokens bound how far workers may
+	// run ahead of the writer (and thus the number of spooled blobs).
+	go func() {
+		defer close(next)
+		for i := range items {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case next <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for k := 0; k < jobs; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] <- w.prepareItem(src, &items[i], i, claims)
+			}
+		}()
+	}
+
+	// --- Append members to the outer tar in path order ---
+	var err error
+	consumed := 0
+	for i := range items {
+		p := <-results[i]
+		consumed++
+		<-tokens
+		err = w.appendItem(src, &items[i], p)
+		p.release()
+		if err != nil {
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+	for i := consumed; i < len(items); i++ {
+		select {
+		case p := <-results[i]:
+			p.release()
+		default:
+		}
+	}
+	// Create and CreateFS record the error: Close removes the archive
+	// instead of writing an index over the members appended so far.
+	if err != nil {
+		return err
+	}
+
+	// --- Finally, write index.zst.aes with sorted unique lines ---
+	return w.finish()
+}
+
+// createItem is one path to archive, as detected before its members are
+// built.
+type createItem struct {
+	path     string
+	hdr      *tar.Header
+	meta     Meta
+	size     int64
+	maybeDup bool // another content has the same size, or incremental
+}
+
+// preparedItem holds the members of one path built by a worker.
+type preparedItem struct {
+	entry   IndexEntry
+	metaEnc []byte
+	hData   string
+	dataEnc *spool // nil when the content is stored by another item
+	size    int64
+	err     error
+}
+
+// release removes the spooled data member, if any.
+func (p *preparedItem) release() {
+	if p.dataEnc != nil {
+		p.dataEnc.Close()
+	}
+}
+
+// dataClaims elects, among the items sharing a content, the one that
+// compresses and encrypts it: the lowest item number wins, so the data
+// member is always written with the first path in order, whatever the
+// scheduling of workers.
+type dataClaims struct {
+	mu    sync.Mutex
+	owner map[string]int
+}
+
+// claim reports whether item i must store the content hData.
+func (c *dataClaims) claim(hData string, i int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if j, ok := c.owner[hData]; ok && j < i {
+		return false
+	}
+	c.owner[hData] = i
+	return true
+}
+
+// prepareItem builds the encrypted meta member of an item and, for regular
+// files, its encrypted data member (unless another item stores it). It
+// runs on worker goroutines and never touches the outer tar.
+func (w *ArchiveWriter) prepareItem(src source, it *createItem, i int, claims *dataClaims) *preparedItem {
+	quoted, raw := escapeForIndex(it.path)
+	p := &preparedItem{entry: IndexEntry{PathRaw: raw, Quoted: quoted}}
+	metaTar, err := buildMetaTar(raw, it.hdr, it.meta)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	if p.metaEnc, p.err = encryptMember(metaTar, w.format.metaMemberName(w.prefixB64, raw), w.cipher); p.err != nil {
+		return p
+	}
+	if it.hdr.Typeflag != tar.TypeReg {
+		return p
+	}
+
+	// Stream the file content through hashing, zstd and encryption.
+	fData, err := src.open(it.path)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	defer fData.Close()
+	rs, seekable := fData.(io.ReadSeeker)
+	if it.maybeDup && seekable {
+		// Possible duplicate: hash first, compress only if elected.
+		if p.hData, p.err = w.hashContent(rs); p.err != nil {
+			return p
+		}
+		p.size = it.size
+		if w.baseData[p.hData] || !claims.claim(p.hData, i) {
+			return p
+		}
+		if _, p.err = rs.Seek(0, io.SeekStart); p.err != nil {
+			return p
+		}
+	}
+	p.hData, p.dataEnc, p.size, p.err = w.encryptData(fData)
+	return p
+}
+
+// appendItem writes the members prepared for an item to the outer tar and
+// records its index entry.
+func (w *ArchiveWriter) appendItem(src source, it *createItem, p *preparedItem) error {
+	if p.err != nil {
+		return p.err
+	}
+	w.added[it.path] = true
+	if err := w.writeMember(w.format.metaMemberName(w.prefixB64, p.entry.PathRaw), 0600, p.metaEnc); err != nil {
+		return err
+	}
+	if it.hdr.Typeflag == tar.TypeReg {
+		switch {
+		case p.dataEnc != nil || w.dataWritten[p.hData]:
+			if err := w.writeData(p.hData, p.dataEnc, p.size); err != nil {
+				return err
+			}
+		default:
+			// The elected item did not store this content (the file
+			// changed after being hashed): store it now.
+			fData, err := src.open(it.path)
+			if err != nil {
+				return err
+			}
+			p.hData, err = w.storeData(fData)
+			fData.Close()
+			if err != nil {
+				return err
+			}
+		}
+		p.entry.HashData = p.hData
+	}
+	w.idx.Entries = append(w.idx.Entries, p.entry)
+	return nil
+}
+
+// describePath reads the attributes of p from src, the way they are
+// archived: a header holding the type and symlink target, and the
+// metadata (permissions, owner, modification time).
+func describePath(src source, p string) (fs.FileInfo, *tar.Header, Meta, error) {
+	fi, err := src.lstat(p)
+	if err != nil {
+		return nil, nil, Meta{}, err
+	}
+	ft, linkname, err := classifyPath(src, p, fi)
+	if err != nil {
+		return nil, nil, Meta{}, err
+	}
+	hdr := &tar.Header{Linkname: linkname}
+	switch ft {
+	case 'f':
+		hdr.Typeflag = tar.TypeReg
+	case 'd':
+		hdr.Typeflag = tar.TypeDir
+	case 'l':
+		hdr.Typeflag = tar.TypeSymlink
+	case 'p':
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		return nil, nil, Meta{}, errors.New("unexpected file type")
+	}
+	uid, gid := fileOwner(fi)
+	meta := Meta{Mode: fi.Mode().Perm(), Uid: uid, Gid: gid, ModTime: fi.ModTime()}
+	return fi, hdr, meta, nil
+}
+
+// classifyPath inspects an fs.FileInfo and returns a short file-type code
+// ('f' regular, 'd' dir, 'l' symlink, 'p' fifo) and the symlink target,
+// read from src.
+func classifyPath(src source, path string, fi fs.FileInfo) (ft byte, linkname string, err error) {
+	mode := fi.Mode()
+	if mode.IsRegular() {
+		return 'f', "", nil
+	}
+	if mode.IsDir() {
+		return 'd', "", nil
+	}
+	if mode&os.ModeSymlink != 0 {
+		ln, e := src.readlink(path)
+		return 'l', ln, e
+	}
+	if mode&os.ModeNamedPipe != 0 {
+		return 'p', "", nil
+	}
+	return 0, "", fmt.Errorf("%w: %s", ErrUnsupportedFile, path)
+}
+
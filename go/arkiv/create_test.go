@@ -0,0 +1,80 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// failingFS is a file system whose regular file "gen/bad.txt" can be
+// listed and stat'ed, but not opened: a worker of the create pipeline
+// fails on it.
+type failingFS struct {
+	fstest.MapFS
+}
+
+var errOpenFailed = errors.New("open failed")
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if name == "gen/bad.txt" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errOpenFailed}
+	}
+	return f.MapFS.Open(name)
+}
+
+// TestCreateFSWorkerError checks that an error of a worker leaves no
+// archive behind, whatever the number of workers.
+func TestCreateFSWorkerError(t *testing.T) {
+	fsys := failingFS{fstest.MapFS{
+		"gen/a.txt":   {Data: []byte("abcde")},
+		"gen/bad.txt": {Data: []byte("zyxwv")},
+		"gen/c.txt":   {Data: []byte("fghij")},
+	}}
+	for _, jobs := range []int{1, 4} {
+		out := filepath.Join(t.TempDir(), "a.arkiv")
+		w := NewArchiveWriterWithOptions(out, []byte("secret"), WriterOptions{Jobs: jobs})
+		if err := w.CreateFS(fsys, []string{"gen"}); !errors.Is(err, errOpenFailed) {
+			t.Fatalf("jobs %d: CreateFS: got %v, want %v", jobs, err, errOpenFailed)
+		}
+		if err := w.AddDir("more", Meta{Mode: 0755}); !errors.Is(err, errOpenFailed) {
+			t.Errorf("jobs %d: AddDir after a failure: got %v", jobs, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("jobs %d: Close: %v", jobs, err)
+		}
+		if _, err := os.Stat(out); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("jobs %d: the failed archive was left: %v", jobs, err)
+		}
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+var errWriteFailed = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+// TestCloseWriteError checks that an archive whose index cannot be
+// written is removed.
+func TestCloseWriteError(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "a.arkiv")
+	w := NewArchiveWriter(out, []byte("secret"))
+	if err := w.AddDir("gen", Meta{Mode: 0755}); err != nil {
+		t.Fatalf("AddDir: %v", err)
+	}
+	w.tw = tar.NewWriter(failingWriter{})
+	if err := w.Close(); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("Close: got %v, want %v", err, errWriteFailed)
+	}
+	if _, err := os.Stat(out); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the failed archive was left: %v", err)
+	}
+}
+
@@ -1,11 +1,11 @@
-package arkivformat
+package arkiv
 
 import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
-	"errors"
+	"fmt"
 	"io"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -60,7 +60,7 @@ func OpenSSLDecryptReader(r io.Reader, password []byte) (io.Reader, error) {
 		return nil, err
 	}
 	if string(head) != opensslHeader {
-		return nil, errors.New("invalid OpenSSL header")
+		return nil, ErrBadCipherHeader
 	}
 
 	// Read the 8-byte salt and derive key/iv.
@@ -184,6 +184,11 @@ func (c *cbcPKCS7Reader) Read(p []byte) (int, error) {
 	if err == io.EOF {
 		// Mark finalization so we can remove padding after decrypting.
 		c.fin = true
+	} else if n == len(c.buf) && n > 0 {
+		// The last full block may be the padded one: keep it until the
+		// underlying reader reports EOF (not all readers return EOF
+		// along with the last bytes).
+		n -= blockSize
 	}
 	if n == 0 {
 		// Not enough to decrypt a whole block yet.
@@ -202,15 +207,15 @@ func (c *cbcPKCS7Reader) Read(p []byte) (int, error) {
 	// On finalization, validate and remove PKCS#7 padding bytes.
 	if c.fin {
 		if len(dec) < blockSize {
-			return 0, errors.New("invalid padding: short final block")
+			return 0, fmt.Errorf("%w: short final block", ErrBadPadding)
 		}
 		padLen := int(dec[len(dec)-1])
 		if padLen == 0 || padLen > blockSize {
-			return 0, errors.New("invalid padding: range")
+			return 0, fmt.Errorf("%w: range", ErrBadPadding)
 		}
 		for i := 0; i < padLen; i++ {
 			if dec[len(dec)-1-i] != byte(padLen) {
-				return 0, errors.New("invalid padding: content")
+				return 0, fmt.Errorf("%w: content", ErrBadPadding)
 			}
 		}
 		dec = dec[:len(dec)-padLen]
@@ -227,3 +232,38 @@ func (c *cbcPKCS7Reader) Read(p []byte) (int, error) {
 	return nw, nil
 }
 
+// memberCipher encrypts and decrypts the members of an archive with the
+// scheme of its format version. Implementations hold the password. name
+// is the name of the member, which authenticated schemes bind to its
+// ciphertext (see memberAD).
+type memberCipher interface {
+	// encryptWriter returns a writer encrypting to w; Close flushes it.
+	encryptWriter(w io.Writer, name string) (io.WriteCloser, error)
+	// decryptReader returns a reader yielding the plaintext of r.
+	decryptReader(r io.Reader, name string) (io.Reader, error)
+	// wellFormed reports whether an encrypted member of size bytes has a
+	// valid layout, which can be told without the password.
+	wellFormed(size int64) bool
+}
+
+// opensslCipher encrypts members like "openssl enc -aes-256-cbc -pbkdf2
+// -md sha256" (format arkiv001).
+type opensslCipher struct {
+	password []byte
+}
+
+// encryptWriter implements memberCipher.
+func (c opensslCipher) encryptWriter(w io.Writer, _ string) (io.WriteCloser, error) {
+	return OpenSSLEncryptWriter(w, c.password)
+}
+
+// decryptReader implements memberCipher.
+func (c opensslCipher) decryptReader(r io.Reader, _ string) (io.Reader, error) {
+	return OpenSSLDecryptReader(r, c.password)
+}
+
+// wellFormed implements memberCipher: header, salt and whole blocks.
+func (c opensslCipher) wellFormed(size int64) bool {
+	return size >= 2*aes.BlockSize && size%aes.BlockSize == 0
+}
+
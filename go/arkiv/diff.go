@@ -0,0 +1,172 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of the changes reported by Diff.
+const (
+	// ChangeAdded: the path only exists in the new archive.
+	ChangeAdded = "added"
+	// ChangeRemoved: the path only exists in the old archive.
+	ChangeRemoved = "removed"
+	// ChangeType: the path changed type (e.g. file to symlink).
+	ChangeType = "type"
+	// ChangeContent: the content of a regular file changed.
+	ChangeContent = "content"
+	// ChangeMeta: mode, owner, modification time or link target changed.
+	ChangeMeta = "meta"
+)
+
+// Change is one difference between two archives.
+type Change struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// String formats the change on one line.
+func (c Change) String() string {
+	s := fmt.Sprintf("%-8s %s", c.Kind, c.Path)
+	if c.Detail != "" {
+		s += " (" + c.Detail + ")"
+	}
+	return s
+}
+
+// Diff compares the archive old with this one, for the paths matching the
+// optional prefixes, and returns the changes sorted by path. Contents are
+// compared by hash: as each archive salts HASH_DATA with its own prefix,
+// the old data members are decrypted and rehashed with the prefix of this
+// archive, once per distinct content, unless both archives share their
+// prefix and hash.
+func (a *ArchiveReader) Diff(old *ArchiveReader, prefixes []string) ([]Change, error) {
+	// Load both indexes and the meta headers of the selected entries.
+	newEntries, newMetas, err := a.selectMetas(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	oldEntries, oldMetas, err := old.selectMetas(prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Old content hashes, translated to the prefix of this archive.
+	rehashed := make(map[string]string)
+	newHash := func(oldHash string) (string, error) {
+		if old.prefixB64 == a.prefixB64 && old.format.Hash == a.format.Hash {
+			return oldHash, nil
+		}
+		if h, ok := rehashed[oldHash]; ok {
+			return h, nil
+		}
+		r, err := old.openData(oldHash)
+		if err != nil {
+			return "", err
+		}
+		h, err := a.format.dataHash(a.prefixB64, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		rehashed[oldHash] = h
+		return h, nil
+	}
+
+	// --- Walk both path lists ---
+	var changes []Change
+	for raw, ne := range newEntries {
+		oe, ok := oldEntries[raw]
+		if !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, Path: raw})
+			continue
+		}
+		nm, om := newMetas[raw], oldMetas[raw]
+		if typeChar(nm) != typeChar(om) {
+			changes = append(changes, Change{Kind: ChangeType, Path: raw, Detail: fmt.Sprintf("%c -> %c", typeChar(om), typeChar(nm))})
+			continue
+		}
+		if ne.HashData != "" && oe.HashData != "" {
+			h, err := newHash(oe.HashData)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", raw, err)
+			}
+			if h != ne.HashData {
+				changes = append(changes, Change{Kind: ChangeContent, Path: raw})
+			}
+		}
+		if detail := metaChanges(om, nm); detail != "" {
+			changes = append(changes, Change{Kind: ChangeMeta, Path: raw, Detail: detail})
+		}
+	}
+	for raw := range oldEntries {
+		if _, ok := newEntries[raw]; !ok {
+			changes = append(changes, Change{Kind: ChangeRemoved, Path: raw})
+		}
+	}
+
+	sortChanges(changes)
+	return changes, nil
+}
+
+// sortChanges sorts changes by path; for one path, content changes come
+// before metadata ones.
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Path != changes[j].Path {
+			return changes[i].Path < changes[j].Path
+		}
+		return changes[i].Kind < changes[j].Kind
+	})
+}
+
+// selectMetas returns the index entries matching prefixes, keyed by raw
+// path, along with their meta headers.
+func (a *ArchiveReader) selectMetas(prefixes []string) (map[string]IndexEntry, map[string]*tar.Header, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return nil, nil, err
+	}
+	var wanted []IndexEntry
+	entries := make(map[string]IndexEntry)
+	for _, e := range a.index.Entries {
+		if matchesPrefix(e.PathRaw, prefixes) {
+			wanted = append(wanted, e)
+			entries[e.PathRaw] = e
+		}
+	}
+	metas, err := a.readMetas(wanted)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range wanted {
+		if metas[e.PathRaw] == nil {
+			return nil, nil, fmt.Errorf("%w for %s", ErrMissingMeta, e.PathRaw)
+		}
+	}
+	return entries, metas, nil
+}
+
+// metaChanges describes the metadata differences between two meta headers
+// of the same type, or returns an empty string. Times are compared to the
+// second, the precision of the shell tools.
+func metaChanges(om, nm *tar.Header) string {
+	var diffs []string
+	if om.Mode&0o7777 != nm.Mode&0o7777 {
+		diffs = append(diffs, fmt.Sprintf("mode %04o -> %04o", om.Mode&0o7777, nm.Mode&0o7777))
+	}
+	if om.Uid != nm.Uid || om.Gid != nm.Gid {
+		diffs = append(diffs, fmt.Sprintf("owner %d:%d -> %d:%d", om.Uid, om.Gid, nm.Uid, nm.Gid))
+	}
+	if om.ModTime.Unix() != nm.ModTime.Unix() {
+		diffs = append(diffs, fmt.Sprintf("mtime %s -> %s", om.ModTime.Local().Format(time.DateTime), nm.ModTime.Local().Format(time.DateTime)))
+	}
+	if om.Linkname != nm.Linkname {
+		diffs = append(diffs, fmt.Sprintf("target %q -> %q", om.Linkname, nm.Linkname))
+	}
+	return strings.Join(diffs, ", ")
+}
+
@@ -0,0 +1,21 @@
+// Package arkiv reads and writes archives in the Arkiv format: a plain tar
+// file holding a zstd-compressed magic, an encrypted hashing prefix, an
+// encrypted textual index, and one encrypted meta member per path plus one
+// deduplicated data member per distinct regular file content.
+//
+// An ArchiveWriter session creates an archive from host paths:
+//
+//	w := arkiv.NewArchiveWriter("backup.arkiv", []byte(pass))
+//	defer w.Close()
+//	err := w.Create([]string{"/etc"})
+//
+// An ArchiveReader session lists or extracts an existing archive:
+//
+//	r := arkiv.NewArchiveReader("backup.arkiv", []byte(pass))
+//	defer r.Close()
+//	err := r.Extract("/restore", []string{"/etc/ssh"})
+//
+// Errors are wrapped around the sentinel values of this package (ErrBadMagic,
+// ErrMissingMeta, ...) and can be tested with errors.Is.
+package arkiv
+
@@ -0,0 +1,80 @@
+package arkiv
+
+import "errors"
+
+// Typed errors returned by reader and writer sessions. They are usually
+// wrapped with some context (member name, path); use errors.Is to test
+// for them.
+var (
+	// ErrBadMagic is returned when magic.zst is missing or does not
+	// contain a supported format identifier.
+	ErrBadMagic = errors.New("bad magic")
+	// ErrUnknownFormat is returned when a writer is asked for a format
+	// version that is not supported (see Formats).
+	ErrUnknownFormat = errors.New("unknown format version")
+	// ErrBadKDF is returned when the key derivation settings of an
+	// archive (kdf.zst) are missing or cannot be parsed.
+	ErrBadKDF = errors.New("bad key derivation settings")
+	// ErrUnexpectedMember is returned when a member is found where the
+	// format requires another one (e.g. prefix.zst.aes after magic.zst).
+	ErrUnexpectedMember = errors.New("unexpected member")
+	// ErrBadPrefix is returned when prefix.zst.aes does not hold 8 bytes.
+	ErrBadPrefix = errors.New("bad prefix")
+	// ErrMissingIndex is returned when the archive has no index.zst.aes.
+	ErrMissingIndex = errors.New("missing index")
+	// ErrBadIndex is returned when a line of the index cannot be parsed.
+	ErrBadIndex = errors.New("bad index")
+	// ErrMissingMeta is returned when an indexed path has no meta member.
+	ErrMissingMeta = errors.New("missing meta")
+	// ErrMissingData is returned when a regular file has no data member.
+	ErrMissingData = errors.New("missing data")
+	// ErrUnsupportedFile is returned when creating an archive from a path
+	// that is neither a regular file, a directory, a symlink nor a FIFO.
+	ErrUnsupportedFile = errors.New("unsupported special file")
+	// ErrDuplicatePath is returned when a path is added twice to an archive.
+	ErrDuplicatePath = errors.New("duplicate path")
+	// ErrClosed is returned when adding entries to a finished archive.
+	ErrClosed = errors.New("archive writer closed")
+	// ErrBadCipherHeader is returned when an encrypted member does not
+	// start with the OpenSSL "Salted__" header.
+	ErrBadCipherHeader = errors.New("invalid OpenSSL header")
+	// ErrBadPadding is returned when the PKCS#7 padding of an encrypted
+	// member is invalid.
+	ErrBadPadding = errors.New("invalid padding")
+	// ErrAuthFailed is returned when a chunk of a member encrypted with
+	// AES-256-GCM fails to authenticate: it was modified, truncated or
+	// reordered.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrHashMismatch is returned when extracted content does not match
+	// the HASH_DATA of its index entry.
+	ErrHashMismatch = errors.New("content hash mismatch")
+	// ErrNotRegular is returned when reading the content of an entry that
+	// is not a regular file (directory, symlink or FIFO).
+	ErrNotRegular = errors.New("not a regular file")
+	// ErrBadBase is returned when the base archive of an incremental
+	// archive cannot be used: missing, replaced or unrelated.
+	ErrBadBase = errors.New("bad base archive")
+	// ErrBadMemberIndex is returned when the member index sidecar of an
+	// archive (ARCHIVE.arkiv.idx) cannot be parsed.
+	ErrBadMemberIndex = errors.New("bad member index")
+	// ErrWrongPassword is returned when prefix.zst.aes, the first
+	// encrypted member, is well-formed but cannot be decrypted with the
+	// password. Errors on later members denote corruption instead.
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrNoIdentity is returned when an archive encrypted for recipients
+	// is opened without an identity matching one of them.
+	ErrNoIdentity = errors.New("no identity matches a recipient of the archive")
+	// ErrBadRecipient is returned when a recipient (public key) cannot be
+	// parsed or used.
+	ErrBadRecipient = errors.New("bad recipient")
+	// ErrBadIdentity is returned when an identity (private key) cannot be
+	// parsed.
+	ErrBadIdentity = errors.New("bad identity")
+	// ErrNoPassword is returned by a PasswordProvider that yields an empty
+	// password.
+	ErrNoPassword = errors.New("no password")
+	// ErrPasswordMismatch is returned when the confirmation of a password
+	// typed on the terminal differs from it.
+	ErrPasswordMismatch = errors.New("passwords do not match")
+)
+
@@ -0,0 +1,432 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ensureParents creates intermediate directories for a path (mkdir -p).
+func ensureParents(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0o755)
+}
+
+// Extract restores files under dest for entries matching optional prefixes.
+// It loads prefix+index lazily, then performs a second pass over the tar
+// to create objects and write data. Members may appear in any order: data
+// blobs are written as soon as they are met, and file and directory
+// metadata is applied AFTER the whole pass, so modes take effect even with
+// restrictive umask and regardless of where meta and data members are.
+// With ReaderOptions.Jobs above 1, members are decrypted and written by a
+// pool of workers; the reported error is then the one of the first failing
+// member in archive order, as with inline extraction. Regular file contents
+// are checked against their HASH_DATA while they are written. The contents
+// an incremental archive omits are read from its chain of base archives.
+func (a *ArchiveReader) Extract(dest string, prefixes []string) error {
+	// Ensure prefix and index are ready.
+	if err := a.ensureLoaded(); err != nil {
+		return err
+	}
+
+	// Build the subset of entries to extract.
+	wanted := make([]IndexEntry, 0, len(a.index.Entries))
+	for _, e := range a.index.Entries {
+		if matchesPrefix(e.PathRaw, prefixes) {
+			wanted = append(wanted, e)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	// Mapping helpers for meta and data names.
+	targetNameHashes := make(map[string]IndexEntry, len(wanted))
+	dataNeeds := make(map[string][]IndexEntry)
+	dataDone := make(map[string]bool)
+
+	for _, e := range wanted {
+		targetNameHashes[a.format.metaMemberName(a.prefixB64, e.PathRaw)] = e
+		if e.HashData != "" {
+			dataName := dataMemberName(e.HashData)
+			dataNeeds[dataName] = append(dataNeeds[dataName], e)
+		}
+	}
+
+	// Helper to convert raw stored path to output filesystem path.
+	st := &extractState{
+		regMeta: make(map[string]*tar.Header),
+		dirMeta: make(map[string]*tar.Header),
+		outPath: func(raw string) string {
+			return localPath(dest, raw)
+		},
+	}
+
+	// Ensure destination exists.
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+
+	// Members are handled inline, or spooled and queued for the workers.
+	dispatch := func(r io.Reader, t extractTask) error {
+		return a.runExtractTask(r, t, st)
+	}
+	var pool *extractPool
+	if a.opts.Jobs > 1 {
+		pool = a.startExtractPool(a.opts.Jobs, st)
+		defer pool.stop()
+		dispatch = pool.dispatch
+	}
+
+	// Second pass: visit the members of src in file order and act on
+	// meta/data. Base archives only provide data members.
+	seq := 0
+	visit := func(src *ArchiveReader) error {
+		f, members, err := src.openMembers()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		for _, m := range members.members {
+			var t extractTask
+			if e, ok := targetNameHashes[m.name]; ok && src == a {
+				// Meta entries for wanted paths.
+				t = extractTask{meta: true, entries: []IndexEntry{e}}
+			} else if entries, ok := dataNeeds[m.name]; ok && !dataDone[m.name] {
+				// Data chunks for wanted regular files. The content is
+				// written to every path sharing it, whether or not their
+				// meta has been seen yet.
+				t = extractTask{entries: entries}
+				dataDone[m.name] = true
+			} else {
+				continue
+			}
+			t.seq = seq
+			t.name = m.name
+			t.cipher = src.cipher
+			seq++
+			if err := dispatch(memberReader(f, m), t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Visit the archive, then, for an incremental archive, its chain of
+	// bases until every wanted content is found.
+	err := visit(a)
+	for src := a; err == nil && len(dataDone) < len(dataNeeds); {
+		if src, err = src.parent(); err != nil || src == nil {
+			break
+		}
+		err = visit(src)
+	}
+	if pool != nil {
+		err = pool.wait(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Apply regular file metadata now that every member has been seen.
+	for _, e := range wanted {
+		if e.HashData == "" {
+			continue
+		}
+		mh := st.regMeta[e.PathRaw]
+		if mh == nil {
+			return fmt.Errorf("%w for regular file %s", ErrMissingMeta, e.PathRaw)
+		}
+		if !dataDone[dataMemberName(e.HashData)] {
+			return fmt.Errorf("%w for regular file %s", ErrMissingData, e.PathRaw)
+		}
+		outPath := st.outPath(e.PathRaw)
+		_ = os.Chmod(outPath, os.FileMode(mh.Mode))
+		_ = chownBestEffort(outPath, mh.Uid, mh.Gid)
+		_ = os.Chtimes(outPath, time.Now(), mh.ModTime)
+	}
+
+	// Apply directory metadata last, deepest first, so that writing
+	// children does not alter the restored modification times.
+	for i := len(wanted) - 1; i >= 0; i-- {
+		mh := st.dirMeta[wanted[i].PathRaw]
+		if mh == nil {
+			continue
+		}
+		outPath := st.outPath(wanted[i].PathRaw)
+		_ = os.Chmod(outPath, os.FileMode(mh.Mode))
+		_ = chownBestEffort(outPath, mh.Uid, mh.Gid)
+		_ = os.Chtimes(outPath, time.Now(), mh.ModTime)
+	}
+
+	// Report quarantined files once everything else is restored.
+	if n := len(st.quarantined); n > 0 {
+		sort.Strings(st.quarantined)
+		return fmt.Errorf("%w: %d file(s) quarantined with the %s suffix, first %s",
+			ErrHashMismatch, n, QuarantineSuffix, st.quarantined[0])
+	}
+	return nil
+}
+
+// extractState is what Extract learns from meta members and applies once
+// every member has been seen. It is shared by the extraction workers.
+type extractState struct {
+	mu      sync.Mutex
+	regMeta map[string]*tar.Header
+	dirMeta map[string]*tar.Header
+	outPath func(raw string) string
+
+	quarantined []string
+}
+
+// extractTask is one wanted member: the meta member of entries[0], or a
+// data member whose content belongs to all entries. seq is the rank of
+// the member among the wanted ones, in archive order. cipher decrypts the
+// member: bases may be written in another format version.
+type extractTask struct {
+	seq     int
+	name    string
+	meta    bool
+	entries []IndexEntry
+	body    *spool
+	cipher  memberCipher
+}
+
+// runExtractTask restores the member of t, whose encrypted bytes are read
+// from r.
+func (a *ArchiveReader) runExtractTask(r io.Reader, t extractTask, st *extractState) error {
+	if !t.meta {
+		return a.extractData(r, t.cipher, t.name, t.entries, st)
+	}
+	e := t.entries[0]
+	mh, err := decodeMeta(r, t.cipher, t.name, e.PathRaw)
+	if err != nil {
+		return err
+	}
+
+	outPath := st.outPath(e.PathRaw)
+	switch mh.Typeflag {
+	case tar.TypeDir:
+		// Directories: create now, apply metadata once their
+		// content has been written.
+		if err := os.MkdirAll(outPath, 0o755); err != nil {
+			return err
+		}
+		st.mu.Lock()
+		st.dirMeta[e.PathRaw] = mh
+		st.mu.Unlock()
+
+	case tar.TypeSymlink:
+		if err := ensureParents(outPath); err != nil {
+			return err
+		}
+		if err := os.Symlink(mh.Linkname, outPath); err != nil {
+			return err
+		}
+		_ = chownBestEffort(outPath, mh.Uid, mh.Gid)
+
+	case tar.TypeFifo:
+		if err := ensureParents(outPath); err != nil {
+			return err
+		}
+		if err := mkfifo(outPath, uint32(mh.Mode)); err != nil {
+			return err
+		}
+		_ = chownBestEffort(outPath, mh.Uid, mh.Gid)
+		_ = os.Chtimes(outPath, time.Now(), mh.ModTime)
+
+	case tar.TypeReg:
+		// Regular files: defer metadata application after data write.
+		st.mu.Lock()
+		st.regMeta[e.PathRaw] = mh
+		st.mu.Unlock()
+	}
+	return nil
+}
+
+// extractPool runs extraction tasks on a fixed number of workers. The
+// queue holds at most one task per worker, so the amount of spooled data
+// stays bounded whatever the archive size.
+type extractPool struct {
+	a     *ArchiveReader
+	st    *extractState
+	tasks chan extractTask
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error
+	errSeq int
+	closed bool
+}
+
+// startExtractPool starts jobs workers restoring members into st.
+func (a *ArchiveReader) startExtractPool(jobs int, st *extractState) *extractPool {
+	p := &extractPool{a: a, st: st, tasks: make(chan extractTask, jobs)}
+	for i := 0; i < jobs; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// work runs queued tasks until the queue is closed. Tasks following a
+// failed one in archive order are skipped.
+func (p *extractPool) work() {
+	defer p.wg.Done()
+	for t := range p.tasks {
+		if !p.failedBefore(t.seq) {
+			r, err := t.body.Reader()
+			if err == nil {
+				err = p.a.runExtractTask(r, t, p.st)
+			}
+			if err != nil {
+				p.fail(t.seq, err)
+			}
+		}
+		t.body.Close()
+	}
+}
+
+// failedBefore reports whether a task preceding seq has failed.
+func (p *extractPool) failedBefore(seq int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil && p.errSeq < seq
+}
+
+// fail records the error of task seq, keeping the earliest one.
+func (p *extractPool) fail(seq int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil || seq < p.errSeq {
+		p.err, p.errSeq = err, seq
+	}
+}
+
+// dispatch spools the member read from r and queues it. It returns an
+// error once a task has failed, so that the reader stops early.
+func (p *extractPool) dispatch(r io.Reader, t extractTask) error {
+	p.mu.Lock()
+	failed := p.err != nil
+	p.mu.Unlock()
+	if failed {
+		return errExtractAborted
+	}
+	body := newSpool(p.a.opts.TempDir)
+	if _, err := io.Copy(body, r); err != nil {
+		body.Close()
+		return err
+	}
+	t.body = body
+	p.tasks <- t
+	return nil
+}
+
+// wait closes the queue, waits for the workers and returns the error of
+// the first failed task, or readErr (the error met while reading the
+// archive) when no task failed.
+func (p *extractPool) wait(readErr error) error {
+	p.stop()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	return readErr
+}
+
+// stop closes the queue and waits for the workers. It may be called more
+// than once.
+func (p *extractPool) stop() {
+	p.mu.Lock()
+	closed := p.closed
+	p.closed = true
+	p.mu.Unlock()
+	if !closed {
+		close(p.tasks)
+	}
+	p.wg.Wait()
+}
+
+// errExtractAborted stops the reading of an archive once an extraction
+// task has failed; the error of that task is reported instead.
+var errExtractAborted = errors.New("extraction aborted")
+
+// extractData decrypts with c and decompresses the data member name from r and
+// writes its content to the output path of every given entry. Files are
+// created owner-only; their final metadata is applied by the caller. The
+// content is hashed while it is written: when it does not match the
+// HASH_DATA of the entries, the files are removed and ErrHashMismatch is
+// returned, or they are quarantined when ReaderOptions.Quarantine is set.
+func (a *ArchiveReader) extractData(r io.Reader, c memberCipher, name string, entries []IndexEntry, st *extractState) error {
+	dr, err := c.decryptReader(r, name)
+	if err != nil {
+		return err
+	}
+	zdec, err := NewZstdDecoder(dr)
+	if err != nil {
+		return err
+	}
+	defer zdec.Close()
+
+	// Open all outputs so the blob is decompressed only once.
+	files := make([]*os.File, 0, len(entries))
+	defer func() {
+		for _, out := range files {
+			out.Close()
+		}
+	}()
+	h := a.format.newHash()
+	_, _ = h.Write([]byte(a.prefixB64))
+	outs := []io.Writer{h}
+	for _, e := range entries {
+		outPath := st.outPath(e.PathRaw)
+		if err := ensureParents(outPath); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		files = append(files, out)
+		outs = append(outs, out)
+	}
+	if _, err := io.Copy(io.MultiWriter(outs...), zdec); err != nil {
+		return err
+	}
+	pending := files
+	files = nil
+	for _, out := range pending {
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+
+	// Check the content against the index.
+	if hex.EncodeToString(h.Sum(nil)) == entries[0].HashData {
+		return nil
+	}
+	if !a.opts.Quarantine {
+		for _, e := range entries {
+			_ = os.Remove(st.outPath(e.PathRaw))
+		}
+		return fmt.Errorf("%w for regular file %s", ErrHashMismatch, entries[0].PathRaw)
+	}
+	for _, e := range entries {
+		outPath := st.outPath(e.PathRaw)
+		if err := os.Rename(outPath, outPath+QuarantineSuffix); err != nil {
+			return err
+		}
+		st.mu.Lock()
+		st.quarantined = append(st.quarantined, e.PathRaw)
+		st.mu.Unlock()
+	}
+	return nil
+}
+
@@ -0,0 +1,48 @@
+package arkiv
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// TestExtractTempDir checks that the workers of Extract spool large
+// members to ReaderOptions.TempDir.
+func TestExtractTempDir(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "a.arkiv")
+	big := make([]byte, spoolMemLimit+1<<20)
+	rand.New(rand.NewSource(1)).Read(big)
+	w := NewArchiveWriter(out, []byte("secret"))
+	err := w.CreateFS(fstest.MapFS{"gen/big.bin": {Data: big}}, []string{"gen"})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("CreateFS: %v", err)
+	}
+
+	// A missing spool directory makes the extraction fail.
+	missing := filepath.Join(dir, "missing")
+	r := NewArchiveReaderWithOptions(out, []byte("secret"), ReaderOptions{Jobs: 4, TempDir: missing})
+	if err := r.Extract(filepath.Join(dir, "x"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Extract with TempDir %s: got %v, want %v", missing, err, fs.ErrNotExist)
+	}
+	r.Close()
+
+	r = NewArchiveReaderWithOptions(out, []byte("secret"), ReaderOptions{Jobs: 4, TempDir: dir})
+	defer r.Close()
+	if err := r.Extract(filepath.Join(dir, "y"), nil); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "y", "gen", "big.bin"))
+	if err != nil || !bytes.Equal(got, big) {
+		t.Errorf("extracted content differs: %v", err)
+	}
+}
+
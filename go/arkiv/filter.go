@@ -0,0 +1,150 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// FilterOptions selects the entries kept by Filter. Patterns use the
+// syntax of path.Match and are matched against the archived paths (as
+// shown by ls) and each of their parent directories, so a pattern naming
+// a directory selects its whole subtree.
+type FilterOptions struct {
+	// Include keeps only the entries matching one of these patterns.
+	// Every entry is kept when it is empty.
+	Include []string
+	// Exclude drops the entries matching one of these patterns, even if
+	// they are included.
+	Exclude []string
+}
+
+// Filter writes to out a new archive holding the selected entries of this
+// one. The password, the key derivation settings and the prefix are
+// unchanged, so the meta/ and data/ members of the selected entries are
+// copied as is, without being decrypted; only index.zst.aes is written
+// anew. An incremental archive gives an incremental archive on the same
+// base. It returns the number of entries kept. When a member cannot be
+// copied, out is removed.
+func (a *ArchiveReader) Filter(out string, opts FilterOptions) (int, error) {
+	for _, p := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return 0, fmt.Errorf("%w: %q", err, p)
+		}
+	}
+	f, members, err := a.openMembers()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// Writing the archive being read would truncate it.
+	if isSameFile(f, out) {
+		return 0, fmt.Errorf("%s is the archive being filtered", out)
+	}
+
+	// --- Select the entries and the members they need ---
+	var kept []IndexEntry
+	wanted := make(map[string]bool)
+	for _, e := range a.index.Entries {
+		if !filterKeeps(e.PathRaw, opts) {
+			continue
+		}
+		kept = append(kept, e)
+		wanted[a.format.metaMemberName(a.prefixB64, e.PathRaw)] = true
+		if e.HashData != "" {
+			name := dataMemberName(e.HashData)
+			if _, ok := members.lookup(name); !ok && a.base == nil {
+				return 0, fmt.Errorf("%w for %s", ErrMissingData, e.PathRaw)
+			}
+			wanted[name] = true
+		}
+	}
+
+	// --- Header members: same key, same prefix, same base ---
+	prefixRaw, err := base64.StdEncoding.DecodeString(a.prefixB64)
+	if err != nil {
+		return 0, err
+	}
+	var base *baseInfo
+	if a.base != nil {
+		rel, err := relativeBasePath(a.resolveBasePath(), out)
+		if err != nil {
+			return 0, err
+		}
+		base = &baseInfo{path: rel, id: a.base.id}
+	}
+	w := NewArchiveWriterWithOptions(out, append([]byte(nil), a.password...), WriterOptions{Format: a.format.Magic})
+	defer w.Close()
+	w.kdf = a.kdf
+	w.master = append([]byte(nil), a.master...)
+	if err := w.start(prefixRaw, base); err != nil {
+		return 0, w.fail(err)
+	}
+
+	// --- Copy the selected members, in archive order ---
+	for _, m := range members.members {
+		if !wanted[m.name] {
+			continue
+		}
+		wanted[m.name] = false
+		if err := w.copyMember(m.name, memberReader(f, m), m.size); err != nil {
+			// Closing the writer removes the partial archive.
+			return 0, w.fail(err)
+		}
+	}
+
+	// --- Write the new index ---
+	w.idx.Entries = kept
+	if err := w.finish(); err != nil {
+		return 0, err
+	}
+	return len(kept), nil
+}
+
+// filterKeeps reports whether the entry raw is selected by opts.
+func filterKeeps(raw string, opts FilterOptions) bool {
+	if len(opts.Include) > 0 && !matchesPattern(raw, opts.Include) {
+		return false
+	}
+	return !matchesPattern(raw, opts.Exclude)
+}
+
+// matchesPattern reports whether the archived path raw, or one of its
+// parent directories, matches one of the patterns.
+func matchesPattern(raw string, patterns []string) bool {
+	for p := unescapeIndexPath(raw); ; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+		if p == "/" || p == "." || path.Dir(p) == p {
+			return false
+		}
+	}
+}
+
+// copyMember writes a member of the outer tar whose content, of the given
+// size, is read from r as is.
+func (w *ArchiveWriter) copyMember(name string, r io.Reader, size int64) error {
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: size}); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+// isSameFile reports whether path names the open file f.
+func isSameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	oi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, oi)
+}
+
@@ -0,0 +1,115 @@
+package arkiv
+
+import (
+	"crypto/sha512"
+	"hash"
+	"io"
+	"sort"
+)
+
+// Format describes a version of the Arkiv format: the payload of its
+// magic.zst member and the codecs of its other members. Readers select
+// the version from magic.zst, writers from WriterOptions.Format.
+type Format struct {
+	// Magic is the payload of magic.zst, which names the version.
+	Magic string
+	// Cipher describes the encryption of the members.
+	Cipher string
+	// Hash names the hash of HASH_NAME and HASH_DATA.
+	Hash string
+	// ShellCompatible reports whether the shell tools read the version.
+	ShellCompatible bool
+	// MasterKey reports whether every member gets a subkey of one master
+	// key per archive, derived from the password with the settings of
+	// kdf.zst or wrapped there for recipients; otherwise the password is
+	// derived for every member.
+	MasterKey bool
+
+	// newCipher returns the cipher of the members for password, in the
+	// formats without a master key.
+	newCipher func(password []byte) (memberCipher, error)
+	// newMasterCipher returns the cipher of the members for the master
+	// key, in the formats with one.
+	newMasterCipher func(master []byte) memberCipher
+	newHash         func() hash.Hash
+	parseIndex      func(r io.Reader) (*Index, error)
+	serializeIndex  func(idx *Index) []byte
+}
+
+// DefaultFormat is the format version written when WriterOptions.Format
+// is empty: authenticated encryption under a master key derived with
+// Argon2id. MagicString must be asked for archives read by the shell
+// tools.
+const DefaultFormat = MagicMasterKey
+
+// formats lists the supported format versions by magic.
+var formats = map[string]*Format{
+	MagicString: {
+		Magic:           MagicString,
+		Cipher:          "AES-256-CBC, PBKDF2-SHA256 (OpenSSL enc)",
+		Hash:            "SHA-512/256",
+		ShellCompatible: true,
+		newCipher:       func(password []byte) (memberCipher, error) { return opensslCipher{password: password}, nil },
+		newHash:         sha512.New512_256,
+		parseIndex:      parseIndex,
+		serializeIndex:  (*Index).Serialize,
+	},
+	MagicAEAD: {
+		Magic:          MagicAEAD,
+		Cipher:         "AES-256-GCM in 64 KiB chunks, PBKDF2-SHA256",
+		Hash:           "SHA-512/256",
+		newCipher:      func(password []byte) (memberCipher, error) { return gcmCipher{memberKey: passwordKeys(password)}, nil },
+		newHash:        sha512.New512_256,
+		parseIndex:     parseIndex,
+		serializeIndex: (*Index).Serialize,
+	},
+	MagicMasterKey: {
+		Magic:           MagicMasterKey,
+		Cipher:          "AES-256-GCM in 64 KiB chunks, HKDF-SHA256 subkeys of a master key",
+		Hash:            "SHA-512/256",
+		MasterKey:       true,
+		newMasterCipher: func(master []byte) memberCipher { return gcmCipher{memberKey: masterKeys(master)} },
+		newHash:         sha512.New512_256,
+		parseIndex:      parseIndex,
+		serializeIndex:  (*Index).Serialize,
+	},
+}
+
+// lookupFormat returns the format version whose magic.zst payload is
+// magic.
+func lookupFormat(magic string) (*Format, bool) {
+	f, ok := formats[magic]
+	return f, ok
+}
+
+// Formats returns the supported format versions, sorted by magic.
+func Formats() []Format {
+	list := make([]Format, 0, len(formats))
+	for _, f := range formats {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Magic < list[j].Magic })
+	return list
+}
+
+// Format returns the format version of the archive.
+func (a *ArchiveReader) Format() (Format, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return Format{}, err
+	}
+	return *a.format, nil
+}
+
+// KeyDerivation describes how the master key of the archive is derived
+// from the password: the function and its parameters, as recorded in the
+// archive. It is empty for the formats without a master key.
+func (a *ArchiveReader) KeyDerivation() (string, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return "", err
+	}
+	if a.kdf == nil {
+		return "", nil
+	}
+	return a.kdf.String(), nil
+}
+
@@ -0,0 +1,560 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compile-time checks of the io/fs interfaces implemented by ArchiveReader.
+var (
+	_ fs.FS         = (*ArchiveReader)(nil)
+	_ fs.StatFS     = (*ArchiveReader)(nil)
+	_ fs.ReadDirFS  = (*ArchiveReader)(nil)
+	_ fs.ReadFileFS = (*ArchiveReader)(nil)
+	_ ReadLinkFS    = (*ArchiveReader)(nil)
+)
+
+// maxSymlinkHops bounds symlink resolution inside the archive.
+const maxSymlinkHops = 40
+
+// fsNode is one file of the archive as seen through io/fs. Nodes are built
+// from the index and the decrypted meta headers; directories that are only
+// implied by index paths have a synthesized header.
+type fsNode struct {
+	name     string
+	entry    IndexEntry
+	hdr      *tar.Header
+	children []string
+}
+
+// fsTree is the io/fs view of the archive, keyed by slash-separated
+// unrooted names ("." is the root).
+type fsTree struct {
+	nodes   map[string]*fsNode
+	sizesMu sync.Mutex
+	sizes   map[string]int64
+}
+
+// fsName converts a raw index path to an io/fs name. Leading "/" and "./"
+// are dropped; paths escaping the root yield false.
+func fsName(pathRaw string) (string, bool) {
+	p := path.Clean(unescapeIndexPath(pathRaw))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		p = "."
+	}
+	return p, fs.ValidPath(p)
+}
+
+// loadFS lazily builds the io/fs tree by reading every meta member.
+func (a *ArchiveReader) loadFS() (*fsTree, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tree != nil {
+		return a.tree, nil
+	}
+	if err := a.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	metas, err := a.readMetas(a.index.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &fsTree{nodes: make(map[string]*fsNode), sizes: make(map[string]int64)}
+	for _, e := range a.index.Entries {
+		name, ok := fsName(e.PathRaw)
+		if !ok {
+			continue
+		}
+		mh := metas[e.PathRaw]
+		if mh == nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: ErrMissingMeta}
+		}
+		t.add(name, &fsNode{name: name, entry: e, hdr: mh})
+	}
+	// The root always exists.
+	if t.nodes["."] == nil {
+		t.nodes["."] = &fsNode{name: ".", hdr: syntheticDirHeader(".")}
+	}
+	for _, n := range t.nodes {
+		sort.Strings(n.children)
+	}
+	a.tree = t
+	return t, nil
+}
+
+// add inserts a node and synthesizes its missing parent directories.
+func (t *fsTree) add(name string, n *fsNode) {
+	if old := t.nodes[name]; old != nil {
+		n.children = old.children
+	}
+	_, existed := t.nodes[name]
+	t.nodes[name] = n
+	if existed || name == "." {
+		return
+	}
+	parent := path.Dir(name)
+	p := t.nodes[parent]
+	if p == nil {
+		p = &fsNode{name: parent, hdr: syntheticDirHeader(parent)}
+		t.add(parent, p)
+	}
+	p.children = append(p.children, name)
+}
+
+// syntheticDirHeader builds the header of a directory implied by paths.
+func syntheticDirHeader(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0o755}
+}
+
+// resolve returns the node of name, following symlinks when follow is set.
+func (a *ArchiveReader) resolve(op, name string, follow bool) (*fsTree, *fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	t, err := a.loadFS()
+	if err != nil {
+		return nil, nil, err
+	}
+	cur := name
+	for hops := 0; ; hops++ {
+		n := t.nodes[cur]
+		if n == nil {
+			return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if !follow || n.hdr.Typeflag != tar.TypeSymlink {
+			return t, n, nil
+		}
+		if hops == maxSymlinkHops {
+			return nil, nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		target := n.hdr.Linkname
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(cur), target)
+		}
+		target = strings.TrimPrefix(path.Clean("/"+target), "/")
+		if target == "" {
+			target = "."
+		}
+		cur = target
+	}
+}
+
+// Open implements fs.FS. Regular files stream their data/ member,
+// directories implement fs.ReadDirFile, and symlinks are followed when
+// their target is inside the archive.
+func (a *ArchiveReader) Open(name string) (fs.File, error) {
+	t, n, err := a.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.hdr.Typeflag == tar.TypeDir {
+		return &dirFile{a: a, t: t, info: &fileInfo{n: n, name: path.Base(name)}}, nil
+	}
+	return &archiveFile{a: a, t: t, n: n, name: path.Base(name)}, nil
+}
+
+// Stat implements fs.StatFS from the decrypted meta headers. Symlinks are
+// followed like os.Stat does. The size of a regular file is computed by
+// decompressing its data member (see fileInfo.Size).
+func (a *ArchiveReader) Stat(name string) (fs.FileInfo, error) {
+	t, n, err := a.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return a.fileInfo("stat", t, n, path.Base(name))
+}
+
+// ReadDir implements fs.ReadDirFS. Entries are sorted by name.
+func (a *ArchiveReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	t, n, err := a.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.hdr.Typeflag != tar.TypeDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return dirEntries(a, t, n), nil
+}
+
+// Lstat implements ReadLinkFS: like Stat, but a final symlink is not
+// followed.
+func (a *ArchiveReader) Lstat(name string) (fs.FileInfo, error) {
+	t, n, err := a.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return a.fileInfo("lstat", t, n, path.Base(name))
+}
+
+// ReadLink implements ReadLinkFS and returns the stored symlink target.
+func (a *ArchiveReader) ReadLink(name string) (string, error) {
+	_, n, err := a.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.hdr.Typeflag != tar.TypeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return n.hdr.Linkname, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (a *ArchiveReader) ReadFile(name string) ([]byte, error) {
+	f, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// dirEntries returns the sorted entries of a directory node.
+func dirEntries(a *ArchiveReader, t *fsTree, n *fsNode) []fs.DirEntry {
+	list := make([]fs.DirEntry, 0, len(n.children))
+	for _, c := range n.children {
+		list = append(list, &dirEntry{a: a, t: t, n: t.nodes[c], name: path.Base(c)})
+	}
+	return list
+}
+
+// dirEntry implements fs.DirEntry. Its Info, like Stat, decompresses the
+// data member of a regular file to compute its size: walking a large tree
+// with Info decompresses every content once.
+type dirEntry struct {
+	a    *ArchiveReader
+	t    *fsTree
+	n    *fsNode
+	name string
+}
+
+// Name returns the base name of the entry.
+func (d *dirEntry) Name() string {
+	return d.name
+}
+
+// IsDir reports whether the entry is a directory.
+func (d *dirEntry) IsDir() bool {
+	return d.n.hdr.Typeflag == tar.TypeDir
+}
+
+// Type returns the type bits of the entry.
+func (d *dirEntry) Type() fs.FileMode {
+	return nodeMode(d.n).Type()
+}
+
+// Info returns the file information of the entry.
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	return d.a.fileInfo("stat", d.t, d.n, d.name)
+}
+
+// String formats the entry like fs.FormatDirEntry.
+func (d *dirEntry) String() string {
+	return fs.FormatDirEntry(d)
+}
+
+// openData opens the data member identified by hashData, in the archive
+// or its chain of bases, and returns a reader of its decrypted and
+// decompressed content. The content is hashed while it is read: at its
+// end, the reader returns ErrHashMismatch instead of io.EOF when it does
+// not match hashData.
+func (a *ArchiveReader) openData(hashData string) (io.ReadCloser, error) {
+	f, members, err := a.openMembers()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := members.lookup(dataMemberName(hashData))
+	if !ok {
+		// Incremental archives find omitted contents in their base.
+		f.Close()
+		p, err := a.parent()
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, ErrMissingData
+		}
+		return p.openData(hashData)
+	}
+	dr, err := a.cipher.decryptReader(memberReader(f, m), m.name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	zdec, err := NewZstdDecoder(dr)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	h := a.format.newHash()
+	_, _ = h.Write([]byte(a.prefixB64))
+	return &dataReader{zdec: zdec, f: f, h: h, want: hashData}, nil
+}
+
+// dataReader streams a data member and releases its resources on Close.
+type dataReader struct {
+	zdec *zstd.Decoder
+	f    *os.File
+	h    hash.Hash
+	want string // HASH_DATA of the content
+}
+
+// Read reads decompressed content and checks its hash at the end.
+func (d *dataReader) Read(p []byte) (int, error) {
+	n, err := d.zdec.Read(p)
+	_, _ = d.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(d.h.Sum(nil)) != d.want {
+		err = fmt.Errorf("%w: %s", ErrHashMismatch, dataMemberName(d.want))
+	}
+	return n, err
+}
+
+// Close releases the decoder and the archive file.
+func (d *dataReader) Close() error {
+	d.zdec.Close()
+	return d.f.Close()
+}
+
+// dataSize returns the decompressed size of the data member hashData,
+// decompressing that member alone on first use. Sizes are cached per
+// hash; the session is not locked while decompressing, so concurrent
+// callers may compute the same size twice.
+func (a *ArchiveReader) dataSize(t *fsTree, hashData string) (int64, error) {
+	t.sizesMu.Lock()
+	size, ok := t.sizes[hashData]
+	t.sizesMu.Unlock()
+	if ok {
+		return size, nil
+	}
+	r, err := a.openData(hashData)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return 0, err
+	}
+	t.sizesMu.Lock()
+	t.sizes[hashData] = n
+	t.sizesMu.Unlock()
+	return n, nil
+}
+
+// fileInfo implements fs.FileInfo from a meta header. Sys returns the
+// *tar.Header of the meta member.
+type fileInfo struct {
+	n    *fsNode
+	name string
+	size int64
+}
+
+// fileInfo returns the information of the node n, named name. The size
+// of a regular file is computed from its data member; failing to read it
+// is an error of the operation op.
+func (a *ArchiveReader) fileInfo(op string, t *fsTree, n *fsNode, name string) (*fileInfo, error) {
+	fi := &fileInfo{n: n, name: name}
+	if n.entry.HashData == "" {
+		return fi, nil
+	}
+	size, err := a.dataSize(t, n.entry.HashData)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: n.name, Err: err}
+	}
+	fi.size = size
+	return fi, nil
+}
+
+// Name returns the base name of the file, as it was opened.
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+// Size returns the content size of regular files, 0 otherwise. Sizes are
+// not stored in the archive: they are computed when the information is
+// built, by decompressing the data member once per content.
+func (fi *fileInfo) Size() int64 {
+	return fi.size
+}
+
+// Mode returns the permission and type bits of the file.
+func (fi *fileInfo) Mode() fs.FileMode {
+	return nodeMode(fi.n)
+}
+
+// nodeMode returns the permission and type bits of the node n.
+func nodeMode(n *fsNode) fs.FileMode {
+	mode := fs.FileMode(n.hdr.Mode).Perm()
+	switch n.hdr.Typeflag {
+	case tar.TypeDir:
+		mode |= fs.ModeDir
+	case tar.TypeSymlink:
+		mode |= fs.ModeSymlink
+	case tar.TypeFifo:
+		mode |= fs.ModeNamedPipe
+	}
+	return mode
+}
+
+// ModTime returns the stored modification time.
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.n.hdr.ModTime
+}
+
+// IsDir reports whether the file is a directory.
+func (fi *fileInfo) IsDir() bool {
+	return fi.n.hdr.Typeflag == tar.TypeDir
+}
+
+// Sys returns the meta *tar.Header (uid, gid, symlink target...).
+func (fi *fileInfo) Sys() any {
+	return fi.n.hdr
+}
+
+// archiveFile is an open non-directory file. Regular files stream their
+// data member on first read and support seeking by re-reading it.
+type archiveFile struct {
+	a    *ArchiveReader
+	t    *fsTree
+	n    *fsNode
+	name string
+	rc   io.ReadCloser
+	pos  int64
+}
+
+// Stat returns the file information, computing the size of a regular
+// file from its data member.
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.a.fileInfo("stat", f.t, f.n, f.name)
+}
+
+// Read reads the content of a regular file.
+func (f *archiveFile) Read(p []byte) (int, error) {
+	n := f.n
+	if n.hdr.Typeflag != tar.TypeReg {
+		return 0, &fs.PathError{Op: "read", Path: n.name, Err: errors.New("not a regular file")}
+	}
+	if n.entry.HashData == "" {
+		return 0, io.EOF
+	}
+	if f.rc == nil {
+		rc, err := f.a.openData(n.entry.HashData)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: n.name, Err: err}
+		}
+		f.rc = rc
+		if _, err := io.CopyN(io.Discard, rc, f.pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	nr, err := f.rc.Read(p)
+	f.pos += int64(nr)
+	return nr, err
+}
+
+// Seek sets the offset of the next Read. Seeking backwards re-opens the
+// data member; seeking relative to the end computes the content size.
+func (f *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.pos + offset
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		abs = fi.Size() + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	if f.rc != nil {
+		if abs >= f.pos {
+			if _, err := io.CopyN(io.Discard, f.rc, abs-f.pos); err != nil && err != io.EOF {
+				return 0, err
+			}
+		} else {
+			f.rc.Close()
+			f.rc = nil
+		}
+	}
+	f.pos = abs
+	return abs, nil
+}
+
+// Close releases the data stream, if any.
+func (f *archiveFile) Close() error {
+	if f.rc == nil {
+		return nil
+	}
+	err := f.rc.Close()
+	f.rc = nil
+	return err
+}
+
+// dirFile is an open directory.
+type dirFile struct {
+	a       *ArchiveReader
+	t       *fsTree
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+// Stat returns the directory information.
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+// Read always fails on directories.
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.n.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = dirEntries(d.a, d.t, d.info.n)
+	}
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.offset += count
+	return rest[:count], nil
+}
+
+// Close is a no-op for directories.
+func (d *dirFile) Close() error {
+	return nil
+}
+
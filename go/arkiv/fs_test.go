@@ -0,0 +1,176 @@
+package arkiv
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// TestFS checks the io/fs view of an archive of the test fixtures against
+// the tree extracted from it.
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "a.arkiv")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join("..", "..", "tests")); err != nil {
+		t.Fatal(err)
+	}
+	w := NewArchiveWriter(out, []byte("secret"))
+	err = w.Create([]string{"src-01", "src-02", "src-03"})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	dest := filepath.Join(dir, "x")
+	if err := NewArchiveReader(out, []byte("secret")).Extract(dest, nil); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	var files []string
+	regular := make(map[string][]byte)
+	err = filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dest {
+			return err
+		}
+		name, _ := filepath.Rel(dest, p)
+		name = filepath.ToSlash(name)
+		files = append(files, name)
+		if d.Type().IsRegular() {
+			regular[name], err = os.ReadFile(p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewArchiveReader(out, []byte("secret"))
+	defer a.Close()
+	if err := fstest.TestFS(a, files...); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range regular {
+		got, err := fs.ReadFile(a, name)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("ReadFile(%s): got %q, %v, want %q", name, got, err, want)
+		}
+		fi, err := fs.Stat(a, name)
+		if err != nil || fi.Size() != int64(len(want)) {
+			t.Errorf("Stat(%s): got %v, want size %d", name, err, len(want))
+		}
+	}
+}
+
+// TestFSConcurrent checks that a fresh reader can be used from several
+// goroutines, its archive being loaded by the first of them.
+func TestFSConcurrent(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "a.arkiv")
+	w := NewArchiveWriter(out, []byte("secret"))
+	err := w.CreateFS(fstest.MapFS{
+		"gen/a.txt": {Data: []byte("abcde")},
+		"gen/b.txt": {Data: []byte("fghij")},
+	}, []string{"gen"})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("CreateFS: %v", err)
+	}
+	a := NewArchiveReader(out, []byte("secret"))
+	defer a.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := "gen/a.txt"
+			if i%2 == 1 {
+				name = "gen/b.txt"
+			}
+			if i%4 < 2 {
+				if _, err := a.Index(); err != nil {
+					t.Errorf("Index: %v", err)
+				}
+			}
+			fi, err := fs.Stat(a, name)
+			if err != nil || fi.Size() != 5 {
+				t.Errorf("Stat(%s): %v", name, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestFSUnreadableData checks that the size of a file whose data member
+// does not decrypt is an error of Stat and of the Info of its directory
+// entry, not a size of 0.
+func TestFSUnreadableData(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "a.arkiv")
+	w := NewArchiveWriter(out, []byte("secret"))
+	err := w.CreateFS(fstest.MapFS{"gen/a.txt": {Data: []byte("abcde")}}, []string{"gen"})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("CreateFS: %v", err)
+	}
+	flipLastByte(t, out, "data/")
+
+	a := NewArchiveReader(out, []byte("secret"))
+	defer a.Close()
+	if _, err := fs.Stat(a, "gen/a.txt"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Stat: got %v, want %v", err, ErrAuthFailed)
+	}
+	entries, err := fs.ReadDir(a, "gen")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir: got %v, %v", entries, err)
+	}
+	if _, err := entries[0].Info(); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Info: got %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+// flipLastByte changes the last byte of the first member of the archive
+// whose name starts with prefix.
+func flipLastByte(t *testing.T, archive, prefix string) {
+	t.Helper()
+	f, err := os.OpenFile(archive, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	members, err := scanMembers(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range members.members {
+		if !strings.HasPrefix(m.name, prefix) {
+			continue
+		}
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, m.offset+m.size-1); err != nil {
+			t.Fatal(err)
+		}
+		b[0] ^= 1
+		if _, err := f.WriteAt(b, m.offset+m.size-1); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	t.Fatalf("no member %s* in %s", prefix, archive)
+}
+
@@ -1,21 +1,29 @@
 //go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
 
-package arkivformat
+package arkiv
 
 import (
 	"os"
 	"syscall"
 )
 
-// getUID extracts the UID from FileInfo on Unix platforms.
+// getUID extracts the UID from FileInfo on Unix platforms, or returns 0
+// when the FileInfo does not come from the host file system.
 func getUID(fi os.FileInfo) int {
-	st := fi.Sys().(*syscall.Stat_t)
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
 	return int(st.Uid)
 }
 
-// getGID extracts the GID from FileInfo on Unix platforms.
+// getGID extracts the GID from FileInfo on Unix platforms, or returns 0
+// when the FileInfo does not come from the host file system.
 func getGID(fi os.FileInfo) int {
-	st := fi.Sys().(*syscall.Stat_t)
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
 	return int(st.Gid)
 }
 
@@ -1,11 +1,13 @@
-package arkivformat
+package arkiv
 
 import (
+	"bufio"
 	"bytes"
-	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -42,6 +44,28 @@ func escapeForIndex(path string) (quoted string, rawBetween string) {
 	return
 }
 
+// unescapeIndexPath reverses escapeForIndex on the raw substring stored
+// between quotes: \\ becomes \ and \" becomes ".
+func unescapeIndexPath(raw string) string {
+	if !strings.Contains(raw, "\\") {
+		return raw
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\\' && i+1 < len(raw) && (raw[i+1] == '\\' || raw[i+1] == '"') {
+			i++
+		}
+		b.WriteByte(raw[i])
+	}
+	return b.String()
+}
+
+// localPath returns the path under root of the file archived as raw: the
+// unescaped path, as Extract writes it and Check reads it.
+func localPath(root, raw string) string {
+	return filepath.Join(root, unescapeIndexPath(raw))
+}
+
 // parseIndexLine parses one line of the index of the form:
 //   "PATH"
 // or
@@ -51,15 +75,20 @@ func escapeForIndex(path string) (quoted string, rawBetween string) {
 func parseIndexLine(line string) (raw string, hash string, err error) {
 	// Must start with a double quote.
 	if !strings.HasPrefix(line, "\"") {
-		return "", "", fmt.Errorf("bad index line: %q", line)
+		return "", "", fmt.Errorf("%w: bad line %q", ErrBadIndex, line)
 	}
 
-	// Find the closing double quote.
-	i := strings.IndexByte(line[1:], '"')
-	if i < 0 {
-		return "", "", fmt.Errorf("unterminated path: %q", line)
+	// Find the closing double quote, skipping the escaped characters.
+	i := 1
+	for i < len(line) && line[i] != '"' {
+		if line[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(line) {
+		return "", "", fmt.Errorf("%w: unterminated path %q", ErrBadIndex, line)
 	}
-	i++ // adjust index since we searched from line[1:]
 
 	// Extract raw substring without quotes.
 	raw = line[1:i]
@@ -71,12 +100,34 @@ func parseIndexLine(line string) (raw string, hash string, err error) {
 
 	// Otherwise expect '=' then the hex hash.
 	if i+1 >= len(line) || line[i+1] != '=' {
-		return "", "", fmt.Errorf("bad index sep: %q", line)
+		return "", "", fmt.Errorf("%w: bad separator %q", ErrBadIndex, line)
 	}
 	hash = line[i+2:]
 	return raw, hash, nil
 }
 
+// parseIndex reads the textual index from r: one entry per non-empty
+// line, as parsed by parseIndexLine.
+func parseIndex(r io.Reader) (*Index, error) {
+	idx := &Index{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		raw, hash, err := parseIndexLine(line)
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries = append(idx.Entries, IndexEntry{PathRaw: raw, HashData: hash, Quoted: "\"" + raw + "\""})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
 // Serialize returns the canonical textual content of the index:
 //   - Deduplicate exact lines byte-wise
 //   - Sort them using byte ordering (LC_ALL=C)
@@ -103,15 +154,39 @@ func (idx *Index) Serialize() []byte {
 	return bytes.Join(lines, []byte{'\n'})
 }
 
-// computeNameHash returns SHA-512/256( PREFIX_BASE64 || PATH_BYTES ) where
-// PATH_BYTES is the exact substring between quotes (no unescaping).
-func computeNameHash(prefixB64 string, pathRaw string) string {
-	h := sha512.New512_256()
+// nameHash returns HASH_NAME = H( PREFIX_BASE64 || PATH_BYTES ), H being
+// the hash of the format, where PATH_BYTES is the exact substring between
+// quotes (no unescaping).
+func (f *Format) nameHash(prefixB64 string, pathRaw string) string {
+	h := f.newHash()
 	_, _ = h.Write([]byte(prefixB64))
 	_, _ = h.Write([]byte(pathRaw))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// dataHash computes HASH_DATA = H(PREFIX_BASE64 || content), H being the
+// hash of the format, from the content read from r.
+func (f *Format) dataHash(prefixB64 string, r io.Reader) (string, error) {
+	h := f.newHash()
+	_, _ = h.Write([]byte(prefixB64))
+	if _, err := io.CopyBuffer(h, r, make([]byte, 1<<20)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// metaMemberName returns the name of the outer tar member holding the
+// metadata of the given raw path: meta/<HASH_NAME>.tar.zst.aes.
+func (f *Format) metaMemberName(prefixB64 string, pathRaw string) string {
+	return "meta/" + f.nameHash(prefixB64, pathRaw) + ".tar.zst.aes"
+}
+
+// dataMemberName returns the name of the outer tar member holding the
+// content identified by hashData: data/<HASH_DATA>.zst.aes.
+func dataMemberName(hashData string) string {
+	return "data/" + hashData + ".zst.aes"
+}
+
 // prefixBytesToBase64 encodes the 8 random prefix bytes to a single-line
 // Base64 string without trailing newline.
 func prefixBytesToBase64(b8 []byte) string {
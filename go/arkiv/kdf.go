@@ -0,0 +1,345 @@
+package arkiv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// kdfMember is the member of the formats keyed by one master key per
+// archive (see Format.MasterKey). It follows magic.zst, is not encrypted,
+// and holds "key=value" lines naming the key derivation function, its
+// parameters and the salt:
+//
+//	kdf=argon2id
+//	time=3
+//	memory=65536
+//	threads=4
+//	salt=HEX
+//
+// scrypt archives declare n, r and p instead of time, memory and threads,
+// PBKDF2-SHA256 archives declare iterations. The master key is derived
+// once from the password with these settings; each member is then
+// encrypted with its own subkey, derived from the master key by HKDF.
+// Archives encrypted for recipients hold a random master key wrapped for
+// each of them instead (kdf=x25519, see Recipient).
+const kdfMember = "kdf.zst"
+
+// kdfSaltSize is the size of the salt of the master key.
+const kdfSaltSize = 32
+
+// Names of the key derivation functions of the master key.
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+	KDFPBKDF2   = "pbkdf2-sha256"
+	// kdfX25519 marks the archives encrypted for recipients.
+	kdfX25519 = "x25519"
+)
+
+// Default parameters of the key derivation functions: the second
+// recommended option of RFC 9106 for Argon2id, and the parameters of the
+// OWASP password storage guidance for scrypt and PBKDF2.
+const (
+	DefaultKDFTime    = 3
+	DefaultKDFMemory  = 64 << 10 // KiB
+	DefaultKDFThreads = 4
+	defaultScryptR    = 8
+	defaultPBKDF2Iter = 600000
+)
+
+// Bounds of the work that a reader accepts to spend on the master key of
+// an archive: the memory of Argon2id and scrypt, in KiB (4 GiB), the
+// passes of Argon2id, the iterations of PBKDF2 (about a minute), and the
+// parallelism of scrypt, which runs sequentially here. Writers refuse
+// settings beyond them too.
+const (
+	kdfMaxMemory     = 4 << 20
+	kdfMaxTime       = 64
+	kdfMaxIterations = 100000000
+	kdfMaxScryptP    = 255
+)
+
+// KDFOptions selects how the master key of a new archive is derived from
+// the password, in the formats with a master key (see Format.MasterKey).
+// Zero fields take the default values.
+type KDFOptions struct {
+	// Name is KDFArgon2id (the default), KDFScrypt or KDFPBKDF2.
+	Name string
+	// Time is the number of passes of Argon2id, or the number of
+	// iterations of PBKDF2. scrypt does not use it.
+	Time uint32
+	// Memory is the memory used by Argon2id and scrypt, in KiB. scrypt
+	// uses the largest cost parameter N (a power of two) fitting in it,
+	// with r = 8.
+	Memory uint32
+	// Threads is the parallelism of Argon2id, or the parameter p of
+	// scrypt.
+	Threads uint8
+}
+
+// kdfParams are the settings deriving the master key of an archive.
+type kdfParams struct {
+	name string
+	// Argon2id.
+	time    uint32
+	memory  uint32
+	threads uint8
+	// scrypt.
+	n, r, p int
+	// PBKDF2.
+	iterations int
+	salt       []byte
+	// X25519 recipients.
+	wrapped []wrappedKey
+}
+
+// newKDFParams returns the settings of a new archive selected by opts,
+// with a random salt.
+func newKDFParams(opts KDFOptions) (*kdfParams, error) {
+	p := &kdfParams{name: opts.Name, salt: make([]byte, kdfSaltSize)}
+	orDefault := func(v, def uint32) uint32 {
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+	switch opts.Name {
+	case "", KDFArgon2id:
+		p.name = KDFArgon2id
+		p.time = orDefault(opts.Time, DefaultKDFTime)
+		p.memory = orDefault(opts.Memory, DefaultKDFMemory)
+		p.threads = uint8(orDefault(uint32(opts.Threads), DefaultKDFThreads))
+	case KDFScrypt:
+		if opts.Time != 0 {
+			return nil, fmt.Errorf("%w: scrypt has no time parameter", ErrBadKDF)
+		}
+		p.r = defaultScryptR
+		p.p = int(orDefault(uint32(opts.Threads), 1))
+		memory := int64(orDefault(opts.Memory, DefaultKDFMemory)) << 10
+		p.n = 2
+		for 128*int64(p.r)*int64(p.n)*2 <= memory {
+			p.n *= 2
+		}
+	case KDFPBKDF2:
+		if opts.Memory != 0 || opts.Threads != 0 {
+			return nil, fmt.Errorf("%w: PBKDF2 has no memory or threads parameter", ErrBadKDF)
+		}
+		p.iterations = int(orDefault(opts.Time, defaultPBKDF2Iter))
+	default:
+		return nil, fmt.Errorf("%w: unknown kdf %q", ErrBadKDF, opts.Name)
+	}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, p.salt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// renewed returns the same settings with a new random salt.
+func (p kdfParams) renewed() (*kdfParams, error) {
+	p.salt = make([]byte, kdfSaltSize)
+	if _, err := io.ReadFull(rand.Reader, p.salt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// check validates the parameters, as set by a writer or read from an
+// archive.
+func (p *kdfParams) check() error {
+	var ok bool
+	switch p.name {
+	case KDFArgon2id:
+		ok = p.time >= 1 && p.time <= kdfMaxTime && p.threads >= 1 &&
+			p.memory >= 8*uint32(p.threads) && p.memory <= kdfMaxMemory
+	case KDFScrypt:
+		ok = p.n > 1 && p.n&(p.n-1) == 0 && p.r >= 1 && p.p >= 1 && p.p <= kdfMaxScryptP &&
+			int64(p.r)*int64(p.p) < 1<<30 && 128*int64(p.r)*int64(p.n) <= kdfMaxMemory<<10
+	case KDFPBKDF2:
+		ok = p.iterations >= 1 && p.iterations <= kdfMaxIterations
+	case kdfX25519:
+		return p.checkWrapped()
+	default:
+		return fmt.Errorf("%w: unsupported kdf %q", ErrBadKDF, p.name)
+	}
+	if !ok || len(p.salt) == 0 {
+		return fmt.Errorf("%w: invalid %s parameters", ErrBadKDF, p.name)
+	}
+	return nil
+}
+
+// checkWrapped validates the wrapped keys of an archive encrypted for
+// recipients.
+func (p *kdfParams) checkWrapped() error {
+	if len(p.wrapped) == 0 {
+		return fmt.Errorf("%w: no recipient", ErrBadKDF)
+	}
+	for _, w := range p.wrapped {
+		if len(w.share) != curve25519.PointSize || len(w.body) != keyLen+chacha20poly1305.Overhead {
+			return fmt.Errorf("%w: invalid recipient", ErrBadKDF)
+		}
+	}
+	return nil
+}
+
+// String describes the key derivation function and its parameters.
+func (p *kdfParams) String() string {
+	switch p.name {
+	case KDFArgon2id:
+		return fmt.Sprintf("argon2id (time %d, memory %d KiB, threads %d)", p.time, p.memory, p.threads)
+	case KDFScrypt:
+		return fmt.Sprintf("scrypt (N %d, r %d, p %d)", p.n, p.r, p.p)
+	case kdfX25519:
+		return fmt.Sprintf("x25519 (%d recipient(s))", len(p.wrapped))
+	}
+	return fmt.Sprintf("pbkdf2-sha256 (%d iterations)", p.iterations)
+}
+
+// encodeKDFParams serializes the content of kdf.zst.
+func encodeKDFParams(p kdfParams) []byte {
+	var b strings.Builder
+	b.WriteString("kdf=" + p.name + "\n")
+	switch p.name {
+	case KDFArgon2id:
+		fmt.Fprintf(&b, "time=%d\nmemory=%d\nthreads=%d\n", p.time, p.memory, p.threads)
+	case KDFScrypt:
+		fmt.Fprintf(&b, "n=%d\nr=%d\np=%d\n", p.n, p.r, p.p)
+	case KDFPBKDF2:
+		fmt.Fprintf(&b, "iterations=%d\n", p.iterations)
+	case kdfX25519:
+		for _, w := range p.wrapped {
+			b.WriteString("recipient=" + hex.EncodeToString(w.share) + " " + hex.EncodeToString(w.body) + "\n")
+		}
+		return []byte(b.String())
+	}
+	b.WriteString("salt=" + hex.EncodeToString(p.salt) + "\n")
+	return []byte(b.String())
+}
+
+// decodeKDFParams parses the content of kdf.zst. Unknown keys are ignored;
+// an unknown key derivation function, or parameters out of bounds, are
+// errors.
+func decodeKDFParams(data []byte) (*kdfParams, error) {
+	p := &kdfParams{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		var n uint64
+		var err error
+		switch key {
+		case "kdf":
+			p.name = value
+		case "salt":
+			p.salt, err = hex.DecodeString(value)
+		case "time", "memory":
+			n, err = strconv.ParseUint(value, 10, 32)
+		case "threads":
+			n, err = strconv.ParseUint(value, 10, 8)
+		case "n", "r", "p", "iterations":
+			n, err = strconv.ParseUint(value, 10, 31)
+		case "recipient":
+			var w wrappedKey
+			share, body, _ := strings.Cut(value, " ")
+			if w.share, err = hex.DecodeString(share); err == nil {
+				w.body, err = hex.DecodeString(body)
+			}
+			p.wrapped = append(p.wrapped, w)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s: %w", ErrBadKDF, kdfMember, key, err)
+		}
+		switch key {
+		case "time":
+			p.time = uint32(n)
+		case "memory":
+			p.memory = uint32(n)
+		case "threads":
+			p.threads = uint8(n)
+		case "n":
+			p.n = int(n)
+		case "r":
+			p.r = int(n)
+		case "p":
+			p.p = int(n)
+		case "iterations":
+			p.iterations = int(n)
+		}
+	}
+	if err := p.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", kdfMember, err)
+	}
+	return p, nil
+}
+
+// readKDFParams decompresses and parses the kdf member m of the archive f.
+func readKDFParams(f *os.File, m member) (*kdfParams, error) {
+	zdec, err := NewZstdDecoder(memberReader(f, m))
+	if err != nil {
+		return nil, err
+	}
+	defer zdec.Close()
+	data, err := io.ReadAll(zdec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", kdfMember, err)
+	}
+	return decodeKDFParams(data)
+}
+
+// kdfMemberReader returns a reader of the content of the kdf member for p
+// and its size.
+func kdfMemberReader(p kdfParams) (io.Reader, int64, error) {
+	data, err := compressKDFParams(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// compressKDFParams returns the content of the kdf member for p.
+func compressKDFParams(p kdfParams) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := NewZstdEncoder(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(encodeKDFParams(p)); err != nil {
+		zw.Close()
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// masterKey derives the master key of the archive from password or, for
+// an archive encrypted for recipients, unwraps it with identities.
+func (p *kdfParams) masterKey(password []byte, identities []*Identity) ([]byte, error) {
+	switch p.name {
+	case kdfX25519:
+		return p.unwrapMaster(identities)
+	case KDFArgon2id:
+		return argon2.IDKey(password, p.salt, p.time, p.memory, p.threads, keyLen), nil
+	case KDFScrypt:
+		return scrypt.Key(password, p.salt, p.n, p.r, p.p, keyLen)
+	}
+	return pbkdf2.Key(password, p.salt, p.iterations, keyLen, sha256.New), nil
+}
+
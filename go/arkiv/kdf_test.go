@@ -0,0 +1,40 @@
+package arkiv
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestKDFBounds checks that writers and readers refuse key derivation
+// settings beyond the bounds, and accept them at the bounds.
+func TestKDFBounds(t *testing.T) {
+	for _, opts := range []KDFOptions{
+		{Name: KDFArgon2id, Time: kdfMaxTime + 1},
+		{Name: KDFArgon2id, Memory: kdfMaxMemory + 1},
+		{Name: KDFPBKDF2, Time: kdfMaxIterations + 1},
+	} {
+		if _, err := newKDFParams(opts); !errors.Is(err, ErrBadKDF) {
+			t.Errorf("newKDFParams(%+v): got %v, want %v", opts, err, ErrBadKDF)
+		}
+	}
+	for _, opts := range []KDFOptions{
+		{Name: KDFArgon2id, Time: kdfMaxTime},
+		{Name: KDFPBKDF2, Time: kdfMaxIterations},
+	} {
+		if _, err := newKDFParams(opts); err != nil {
+			t.Errorf("newKDFParams(%+v): %v", opts, err)
+		}
+	}
+	const salt = "salt=00112233\n"
+	for _, data := range []string{
+		"kdf=argon2id\ntime=65\nmemory=65536\nthreads=4\n" + salt,
+		"kdf=argon2id\ntime=3\nmemory=4194305\nthreads=4\n" + salt,
+		"kdf=scrypt\nn=65536\nr=8\np=256\n" + salt,
+		"kdf=pbkdf2-sha256\niterations=100000001\n" + salt,
+	} {
+		if _, err := decodeKDFParams([]byte(data)); !errors.Is(err, ErrBadKDF) {
+			t.Errorf("decodeKDFParams(%q): got %v, want %v", data, err, ErrBadKDF)
+		}
+	}
+}
+
@@ -1,11 +1,9 @@
-package arkivformat
+package arkiv
 
 import (
 	"archive/tar"
 	"fmt"
-	"os"
 	"os/user"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -46,7 +44,8 @@ func formatLocalTime(t time.Time) string {
 	return t.In(time.Local).Format("2006-01-02 15:04")
 }
 
-// List prints an ls-like listing for entries matching optional prefixes.
+// List prints an ls-like listing for entries matching optional prefixes
+// to the Output of the reader options (standard output by default).
 // It performs two passes: first to lazily load prefix+index, second to
 // iterate tar members and collect meta headers, printing in index order.
 func (a *ArchiveReader) List(prefixes []string) error {
@@ -66,86 +65,28 @@ func (a *ArchiveReader) List(prefixes []string) error {
 		return nil
 	}
 
-	// Build a set of required meta object names.
-	required := make(map[string]struct{}, len(wanted))
-	for _, e := range wanted {
-		hName := computeNameHash(a.prefixB64, e.PathRaw)
-		name := filepath.ToSlash(filepath.Join("meta", hName+".tar.zst.aes"))
-		required[name] = struct{}{}
-	}
-
-	// Map of meta header by object name.
-	metas := make(map[string]*tar.Header, len(required))
-
-	// Open the archive for the second pass.
-	f, err := os.Open(a.path)
+	// Read the meta headers of the selected entries.
+	metas, err := a.readMetas(wanted)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	tr := tar.NewReader(f)
-
-	// Skip magic.zst and prefix.zst.aes.
-	if _, err := tr.Next(); err != nil {
-		return err
-	}
-	if _, err := tr.Next(); err != nil {
-		return err
-	}
-
-	// Walk members to capture the meta we need.
-	remaining := len(required)
-	for remaining > 0 {
-		hdr, err := tr.Next()
-		if err != nil {
-			return err
-		}
-		if _, ok := required[hdr.Name]; ok {
-			dr, err := OpenSSLDecryptReader(tr, a.password)
-			if err != nil {
-				return err
-			}
-			zdec, err := NewZstdDecoder(dr)
-			if err != nil {
-				return err
-			}
-			mtr := tar.NewReader(zdec)
-			mh, err := mtr.Next()
-			zdec.Close()
-			if err != nil {
-				return err
-			}
-			metas[hdr.Name] = mh
-			remaining--
-		}
-	}
 
 	// Print output in index order for the selected entries.
 	for _, e := range wanted {
-		hName := computeNameHash(a.prefixB64, e.PathRaw)
-		metaName := filepath.ToSlash(filepath.Join("meta", hName+".tar.zst.aes"))
-		mh := metas[metaName]
+		mh := metas[e.PathRaw]
 		if mh == nil {
-			return fmt.Errorf("meta chunk not found for %s", e.PathRaw)
+			return fmt.Errorf("%w for %s", ErrMissingMeta, e.PathRaw)
 		}
 
 		// Pick a single-char type marker.
-		var typeCh rune = '-'
-		switch mh.Typeflag {
-		case tar.TypeDir:
-			typeCh = 'd'
-		case tar.TypeSymlink:
-			typeCh = 'l'
-		case tar.TypeFifo:
-			typeCh = 'p'
-		}
+		typeCh := typeChar(mh)
 
 		// Resolve owner and format time in local timezone.
 		owner := ownerString(mh.Uid, mh.Gid)
 		when := formatLocalTime(mh.ModTime)
 
-		fmt.Printf(
+		fmt.Fprintf(
+			a.output(),
 			"%c %04o %s %s %s\n",
 			typeCh,
 			mh.Mode,
@@ -177,3 +118,59 @@ func matchesPrefix(pathRaw string, prefixes []string) bool {
 	return false
 }
 
+// typeChar returns the single-char type marker of a meta header, as shown
+// by ls -l: '-', 'd', 'l' or 'p'.
+func typeChar(mh *tar.Header) rune {
+	switch mh.Typeflag {
+	case tar.TypeDir:
+		return 'd'
+	case tar.TypeSymlink:
+		return 'l'
+	case tar.TypeFifo:
+		return 'p'
+	}
+	return '-'
+}
+
+// readMetas reads the meta members of the given entries and returns the meta
+// header of every given entry, keyed by raw path. Entries whose meta
+// member is absent are missing from the result.
+func (a *ArchiveReader) readMetas(entries []IndexEntry) (map[string]*tar.Header, error) {
+	// Build a set of required meta object names.
+	required := make(map[string][]string, len(entries))
+	for _, e := range entries {
+		name := a.format.metaMemberName(a.prefixB64, e.PathRaw)
+		required[name] = append(required[name], e.PathRaw)
+	}
+
+	// Map of meta header by raw path.
+	metas := make(map[string]*tar.Header, len(entries))
+
+	// Open the archive and locate its members.
+	f, members, err := a.openMembers()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Read the meta members we need, in file order.
+	for _, m := range members.members {
+		if len(required) == 0 {
+			break
+		}
+		raws, ok := required[m.name]
+		if !ok {
+			continue
+		}
+		mh, err := decodeMeta(memberReader(f, m), a.cipher, m.name, raws[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range raws {
+			metas[raw] = mh
+		}
+		delete(required, m.name)
+	}
+	return metas, nil
+}
+
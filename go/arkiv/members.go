@@ -0,0 +1,222 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// memberIndexHeader starts the first line of a member index sidecar. The
+// line goes on with the size and the modification time (in nanoseconds)
+// of the archive it describes.
+const memberIndexHeader = "arkiv-idx 1"
+
+// member locates the content of one member of the outer tar.
+type member struct {
+	name   string
+	offset int64
+	size   int64
+}
+
+// memberTable lists the members of an archive in file order, so that
+// readers can seek to the members they need instead of scanning the tar.
+type memberTable struct {
+	members []member
+	byName  map[string]int
+}
+
+// newMemberTable builds the lookup map of a member list. When a name
+// appears twice, the first member wins, as with a sequential scan.
+func newMemberTable(members []member) *memberTable {
+	t := &memberTable{members: members, byName: make(map[string]int, len(members))}
+	for i, m := range members {
+		if _, ok := t.byName[m.name]; !ok {
+			t.byName[m.name] = i
+		}
+	}
+	return t
+}
+
+// lookup returns the member called name.
+func (t *memberTable) lookup(name string) (member, bool) {
+	i, ok := t.byName[name]
+	if !ok {
+		return member{}, false
+	}
+	return t.members[i], true
+}
+
+// scanMembers walks the headers of the outer tar read from f and records
+// where the content of each member starts. Contents are skipped with
+// Seek, so only the tar headers are read.
+func scanMembers(f *os.File) (*memberTable, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var members []member
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// archive/tar reads f without buffering: the file offset is the
+		// start of the member content.
+		off, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member{name: hdr.Name, offset: off, size: hdr.Size})
+	}
+	return newMemberTable(members), nil
+}
+
+// memberIndexPath returns the path of the sidecar of an archive.
+func memberIndexPath(archive string) string {
+	return archive + MemberIndexSuffix
+}
+
+// readMemberIndex loads the member table of an archive from its sidecar.
+// It returns nil without error when there is no sidecar or when it was
+// written for another version of the archive (different size or
+// modification time).
+func readMemberIndex(archive string, fi os.FileInfo) (*memberTable, error) {
+	f, err := os.Open(memberIndexPath(archive))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 4096), 1<<20)
+
+	// --- Header: format and archive identity ---
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: empty file", ErrBadMemberIndex)
+	}
+	fields := strings.Fields(strings.TrimPrefix(s.Text(), memberIndexHeader))
+	if !strings.HasPrefix(s.Text(), memberIndexHeader+" ") || len(fields) != 2 {
+		return nil, fmt.Errorf("%w: bad header", ErrBadMemberIndex)
+	}
+	size, err1 := strconv.ParseInt(fields[0], 10, 64)
+	mtime, err2 := strconv.ParseInt(fields[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%w: bad header", ErrBadMemberIndex)
+	}
+	if size != fi.Size() || mtime != fi.ModTime().UnixNano() {
+		return nil, nil
+	}
+
+	// --- Members: "OFFSET SIZE NAME", in file order ---
+	var members []member
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%w: line %d", ErrBadMemberIndex, len(members)+2)
+		}
+		off, err1 := strconv.ParseInt(parts[0], 10, 64)
+		n, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 != nil || err2 != nil || off < 0 || n < 0 || off+n > size {
+			return nil, fmt.Errorf("%w: line %d", ErrBadMemberIndex, len(members)+2)
+		}
+		members = append(members, member{name: parts[2], offset: off, size: n})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return newMemberTable(members), nil
+}
+
+// writeMemberIndex writes the sidecar of an archive. The file is written
+// under a temporary name and renamed, so readers never see a partial one.
+func writeMemberIndex(archive string, fi os.FileInfo, t *memberTable) error {
+	path := memberIndexPath(archive)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "%s %d %d\n", memberIndexHeader, fi.Size(), fi.ModTime().UnixNano())
+	for _, m := range t.members {
+		fmt.Fprintf(w, "%d %d %s\n", m.offset, m.size, m.name)
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadMembers returns the member table of the archive opened as f: from
+// the sidecar when it matches the archive, from a scan of the tar headers
+// otherwise.
+func (a *ArchiveReader) loadMembers(f *os.File) (*memberTable, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	t, err := readMemberIndex(a.path, fi)
+	if err != nil || t != nil {
+		return t, err
+	}
+	return scanMembers(f)
+}
+
+// Reindex scans the archive and writes its member index sidecar
+// (ARCHIVE.arkiv.idx), which maps each member of the outer tar to its
+// offset and size. Later sessions use it to seek directly to the members
+// they need; it is ignored once the archive is modified. The password is
+// not needed and the sidecar holds no secret: member names are hashes.
+func (a *ArchiveReader) Reindex() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	t, err := scanMembers(f)
+	if err != nil {
+		return err
+	}
+	return writeMemberIndex(a.path, fi, t)
+}
+
+// openMembers opens the archive and returns it along with its member
+// table, loading the prefix and the index on first use.
+func (a *ArchiveReader) openMembers() (*os.File, *memberTable, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, a.members, nil
+}
+
+// memberReader returns a reader of the content of m in the archive f.
+func memberReader(f *os.File, m member) io.Reader {
+	return io.NewSectionReader(f, m.offset, m.size)
+}
+
@@ -0,0 +1,76 @@
+package arkiv
+
+import (
+	"io"
+	"os"
+)
+
+// ReaderOptions holds the optional settings of a read session. The zero
+// value gives the default behaviour of the arkiv-format tool.
+type ReaderOptions struct {
+	// Output receives the listing printed by List. Nil means os.Stdout.
+	Output io.Writer
+	// Jobs is the number of goroutines decrypting, decompressing and
+	// writing members during Extract. Members are read by a single
+	// goroutine and handed to the workers; large ones are spooled to
+	// TempDir. Values below 2 extract inline.
+	Jobs int
+	// TempDir is where large members are spooled before a worker of
+	// Extract takes them. Empty means os.TempDir().
+	TempDir string
+	// Quarantine changes what Extract does with a file whose content does
+	// not match its HASH_DATA: instead of failing at once, the file is
+	// renamed with QuarantineSuffix and extraction goes on. Extract still
+	// returns an error wrapping ErrHashMismatch at the end.
+	Quarantine bool
+	// Identities decrypt the archives encrypted for recipients (see
+	// WriterOptions.Recipients) instead of the password.
+	Identities []*Identity
+}
+
+// QuarantineSuffix is appended to the name of extracted files whose
+// content does not match the index (see ReaderOptions.Quarantine).
+const QuarantineSuffix = ".arkiv-corrupt"
+
+// WriterOptions holds the optional settings of a write session. The zero
+// value gives the default behaviour of the arkiv-format tool.
+type WriterOptions struct {
+	// TempDir is where large data members are spooled while they are
+	// compressed and encrypted. Empty means os.TempDir().
+	TempDir string
+	// Jobs is the number of goroutines hashing, compressing and encrypting
+	// members during Create and CreateFS. Members are still written in a
+	// deterministic order. Values below 1 mean 1.
+	Jobs int
+	// Base makes an incremental archive: the path of a previous archive
+	// (full or incremental, same password) whose prefix is reused and
+	// whose stored contents are not written again. Readers need the base
+	// archive, at the recorded path, to restore those contents.
+	Base string
+	// Format is the magic of the format version to write (see Formats):
+	// DefaultFormat when empty, MagicString for archives readable by the
+	// shell tools, or MagicAEAD for authenticated encryption without a
+	// master key. Readers select the version from the archive itself.
+	Format string
+	// KDF selects how the master key is derived from the password in the
+	// formats with one (see Format.MasterKey); the zero value gives
+	// Argon2id with the default parameters. Readers use the settings
+	// recorded in the archive.
+	KDF KDFOptions
+	// Recipients encrypts the archive for these public keys instead of
+	// the password: a random master key encrypts the members and is
+	// wrapped for each recipient in kdf.zst, so that only their
+	// identities read the archive (see ReaderOptions.Identities). The
+	// format must have a master key. The writer cannot read such an
+	// archive, so Base must be empty.
+	Recipients []*Recipient
+}
+
+// output returns the writer used for listings.
+func (a *ArchiveReader) output() io.Writer {
+	if a.opts.Output == nil {
+		return os.Stdout
+	}
+	return a.opts.Output
+}
+
@@ -0,0 +1,156 @@
+package arkiv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// PasswordProvider supplies the password of an archive. confirm is set when
+// the password is chosen for a new archive, so that interactive providers
+// ask for it twice. Implementations must return ErrNoPassword rather than
+// an empty password.
+type PasswordProvider interface {
+	Password(confirm bool) ([]byte, error)
+}
+
+// PasswordFunc adapts an ordinary function to PasswordProvider.
+type PasswordFunc func(confirm bool) ([]byte, error)
+
+// Password calls f(confirm).
+func (f PasswordFunc) Password(confirm bool) ([]byte, error) {
+	return f(confirm)
+}
+
+// EnvPassword reads the password from the environment variable name (e.g.
+// EnvPass). The variable is visible to other processes of the same user;
+// prefer the other providers on shared hosts.
+func EnvPassword(name string) PasswordProvider {
+	return PasswordFunc(func(bool) ([]byte, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return nil, fmt.Errorf("%w: %s is not set", ErrNoPassword, name)
+		}
+		return []byte(v), nil
+	})
+}
+
+// FilePassword reads the password from the first line of the file at path.
+func FilePassword(path string) PasswordProvider {
+	return PasswordFunc(func(bool) ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readPasswordLine(f, path)
+	})
+}
+
+// FDPassword reads the password from the first line of the inherited file
+// descriptor fd (e.g. 3 with "3< secret.txt" or a pipe set up by the
+// caller). The descriptor is closed afterwards.
+func FDPassword(fd uintptr) PasswordProvider {
+	return PasswordFunc(func(bool) ([]byte, error) {
+		name := fmt.Sprintf("file descriptor %d", fd)
+		f := os.NewFile(fd, name)
+		if f == nil {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		defer f.Close()
+		return readPasswordLine(f, name)
+	})
+}
+
+// CommandPassword runs command with /bin/sh (e.g. a local secret helper
+// such as "pass show backup") and reads the password from the first line
+// of its output. The command inherits stdin and stderr, so it may prompt.
+func CommandPassword(command string) PasswordProvider {
+	return PasswordFunc(func(bool) ([]byte, error) {
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("password command: %w", err)
+		}
+		defer wipe(out)
+		return readPasswordLine(bytes.NewReader(out), "password command")
+	})
+}
+
+// PromptPassword asks for the password on the controlling terminal,
+// without echo, showing prompt (e.g. "Password: "). When confirm is set it
+// is asked twice and ErrPasswordMismatch is returned if they differ.
+func PromptPassword(prompt string) PasswordProvider {
+	return PasswordFunc(func(confirm bool) ([]byte, error) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			// No /dev/tty (e.g. Windows): use stdin if it is a terminal.
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return nil, fmt.Errorf("%w: no terminal to prompt for it", ErrNoPassword)
+			}
+			tty = os.Stdin
+		} else {
+			defer tty.Close()
+		}
+		ask := func(prompt string) ([]byte, error) {
+			fmt.Fprint(tty, prompt)
+			pw, err := term.ReadPassword(int(tty.Fd()))
+			fmt.Fprintln(tty)
+			return pw, err
+		}
+		if prompt == "" {
+			prompt = "Password: "
+		}
+		pw, err := ask(prompt)
+		if err != nil {
+			return nil, err
+		}
+		if len(pw) == 0 {
+			return nil, ErrNoPassword
+		}
+		if !confirm {
+			return pw, nil
+		}
+		again, err := ask("Confirm " + strings.ToLower(prompt[:1]) + prompt[1:])
+		defer wipe(again)
+		if err != nil {
+			wipe(pw)
+			return nil, err
+		}
+		if !bytes.Equal(pw, again) {
+			wipe(pw)
+			return nil, ErrPasswordMismatch
+		}
+		return pw, nil
+	})
+}
+
+// readPasswordLine returns the first line of r, without its end of line.
+// name describes the source in errors.
+func readPasswordLine(r io.Reader, name string) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoPassword, name)
+	}
+	return line, nil
+}
+
+// wipe overwrites b with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
@@ -0,0 +1,343 @@
+package arkiv
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Archives of format arkiv003 can be encrypted for recipients instead of a
+// password: the master key is random, and kdf.zst holds one copy of it
+// wrapped for each recipient's X25519 public key, as age does:
+//
+//	kdf=x25519
+//	recipient=EPHEMERAL_SHARE_HEX WRAPPED_KEY_HEX
+//
+// For each recipient, an ephemeral X25519 key is drawn; the wrapping key
+// is HKDF-SHA256(shared secret, EPHEMERAL_SHARE || RECIPIENT, "arkiv003
+// x25519") and the master key is sealed with ChaCha20-Poly1305 under a
+// zero nonce. Writers only need the public keys, so they cannot decrypt
+// what they wrote. Keys use the encoding of age ("age1..." recipients and
+// "AGE-SECRET-KEY-1..." identities), so age-keygen can generate them.
+
+// Bech32 prefixes of the encoded keys.
+const (
+	recipientHRP = "age"
+	identityHRP  = "age-secret-key-"
+	x25519Info   = "arkiv003 x25519"
+)
+
+// Recipient is the X25519 public key of someone who can decrypt the
+// archives encrypted for them.
+type Recipient struct {
+	key []byte
+}
+
+// ParseRecipient decodes a recipient ("age1...").
+func ParseRecipient(s string) (*Recipient, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrBadRecipient, s, err)
+	}
+	if hrp != recipientHRP || len(key) != curve25519.PointSize {
+		return nil, fmt.Errorf("%w: %q is not an X25519 recipient", ErrBadRecipient, s)
+	}
+	return &Recipient{key: key}, nil
+}
+
+// String encodes the recipient ("age1...").
+func (r *Recipient) String() string {
+	s, _ := bech32Encode(recipientHRP, r.key)
+	return s
+}
+
+// Identity is the X25519 private key of a recipient. It decrypts the
+// archives encrypted for its Recipient.
+type Identity struct {
+	key []byte
+}
+
+// GenerateIdentity returns a new random identity.
+func GenerateIdentity() (*Identity, error) {
+	key := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseIdentity decodes an identity ("AGE-SECRET-KEY-1...").
+func ParseIdentity(s string) (*Identity, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadIdentity, err)
+	}
+	if hrp != identityHRP || len(key) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("%w: not an X25519 identity", ErrBadIdentity)
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseIdentities reads the identities of an identity file: one per line,
+// empty lines and lines starting with '#' being ignored.
+func ParseIdentities(r io.Reader) ([]*Identity, error) {
+	var ids []*Identity
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := ParseIdentity(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no identity found", ErrBadIdentity)
+	}
+	return ids, nil
+}
+
+// ReadIdentityFile reads the identities of the identity file at path.
+func ReadIdentityFile(path string) ([]*Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ids, err := ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// String encodes the identity ("AGE-SECRET-KEY-1...").
+func (id *Identity) String() string {
+	s, _ := bech32Encode(identityHRP, id.key)
+	return strings.ToUpper(s)
+}
+
+// Recipient returns the public key of the identity.
+func (id *Identity) Recipient() *Recipient {
+	key, _ := curve25519.X25519(id.key, curve25519.Basepoint)
+	return &Recipient{key: key}
+}
+
+// wrappedKey is the master key of an archive sealed for one recipient.
+type wrappedKey struct {
+	share []byte // ephemeral X25519 public key
+	body  []byte // sealed master key
+}
+
+// wrapKey seals master for the recipient r.
+func wrapKey(master []byte, r *Recipient) (wrappedKey, error) {
+	eph := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, eph); err != nil {
+		return wrappedKey{}, err
+	}
+	share, err := curve25519.X25519(eph, curve25519.Basepoint)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	shared, err := curve25519.X25519(eph, r.key)
+	if err != nil {
+		return wrappedKey{}, fmt.Errorf("%w: %s", ErrBadRecipient, r)
+	}
+	aead, err := wrappingAEAD(shared, share, r.key)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return wrappedKey{share: share, body: aead.Seal(nil, nonce, master, nil)}, nil
+}
+
+// unwrap opens the master key with the identity id. It reports false when
+// the key was not wrapped for id.
+func (w wrappedKey) unwrap(id *Identity) ([]byte, bool) {
+	shared, err := curve25519.X25519(id.key, w.share)
+	if err != nil {
+		return nil, false
+	}
+	aead, err := wrappingAEAD(shared, w.share, id.Recipient().key)
+	if err != nil {
+		return nil, false
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	master, err := aead.Open(nil, nonce, w.body, nil)
+	return master, err == nil
+}
+
+// wrappingAEAD returns the cipher wrapping the master key for the shared
+// secret of an ephemeral share and a recipient.
+func wrappingAEAD(shared, share, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), share...), recipient...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(x25519Info)), key); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+// newRecipientParams returns the kdf.zst settings of a new archive
+// encrypted for recipients, and its random master key.
+func newRecipientParams(recipients []*Recipient) (*kdfParams, []byte, error) {
+	master := make([]byte, keyLen)
+	if _, err := io.ReadFull(rand.Reader, master); err != nil {
+		return nil, nil, err
+	}
+	p := &kdfParams{name: kdfX25519}
+	for _, r := range recipients {
+		w, err := wrapKey(master, r)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.wrapped = append(p.wrapped, w)
+	}
+	return p, master, nil
+}
+
+// unwrapMaster returns the master key wrapped in p for one of identities.
+func (p *kdfParams) unwrapMaster(identities []*Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%w: the archive is encrypted for recipients", ErrNoIdentity)
+	}
+	for _, w := range p.wrapped {
+		for _, id := range identities {
+			if master, ok := w.unwrap(id); ok {
+				return master, nil
+			}
+		}
+	}
+	return nil, ErrNoIdentity
+}
+
+// Bech32 encoding (BIP 173), without the 90 character limit, as used by
+// age for its keys.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Polymod computes the checksum of values.
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand returns the human-readable part as checksummed.
+func bech32HRPExpand(hrp string) []byte {
+	v := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		v = append(v, hrp[i]>>5)
+	}
+	v = append(v, 0)
+	for i := 0; i < len(hrp); i++ {
+		v = append(v, hrp[i]&31)
+	}
+	return v
+}
+
+// convertBits regroups data from groups of from bits to groups of to bits.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	var out []byte
+	maxv := uint(1)<<to - 1
+	for _, v := range data {
+		if uint(v)>>from != 0 {
+			return nil, errors.New("invalid data")
+		}
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+// bech32Encode encodes data with the human-readable part hrp, lowercase.
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	hrp = strings.ToLower(hrp)
+	mod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(mod>>(5*(5-i)))&31])
+	}
+	return b.String(), nil
+}
+
+// bech32Decode decodes s and returns its lowercase human-readable part and
+// its data.
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("invalid separator")
+	}
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, errors.New("invalid character")
+		}
+	}
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, errors.New("invalid character")
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
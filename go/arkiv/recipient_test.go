@@ -0,0 +1,70 @@
+package arkiv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// An identity of the test vectors of age, whose key is 32 bytes 0x42, and
+// its recipient.
+const (
+	testIdentity  = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+	testRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+)
+
+// TestAgeKeys checks the encoding of the keys against a vector of age.
+func TestAgeKeys(t *testing.T) {
+	id, err := ParseIdentity(testIdentity)
+	if err != nil {
+		t.Fatalf("ParseIdentity: %v", err)
+	}
+	if !bytes.Equal(id.key, bytes.Repeat([]byte{0x42}, 32)) {
+		t.Errorf("identity key: got %x", id.key)
+	}
+	if s := id.String(); s != testIdentity {
+		t.Errorf("identity: got %s, want %s", s, testIdentity)
+	}
+	if s := id.Recipient().String(); s != testRecipient {
+		t.Errorf("recipient: got %s, want %s", s, testRecipient)
+	}
+	r, err := ParseRecipient(testRecipient)
+	if err != nil {
+		t.Fatalf("ParseRecipient: %v", err)
+	}
+	if !bytes.Equal(r.key, id.Recipient().key) {
+		t.Errorf("recipient key: got %x, want %x", r.key, id.Recipient().key)
+	}
+	// a changed character breaks the checksum; keys of the other kind
+	// are refused
+	bad := testRecipient[:len(testRecipient)-1] + "q"
+	if _, err := ParseRecipient(bad); !errors.Is(err, ErrBadRecipient) {
+		t.Errorf("ParseRecipient(%s): got %v, want %v", bad, err, ErrBadRecipient)
+	}
+	if _, err := ParseRecipient(testIdentity); !errors.Is(err, ErrBadRecipient) {
+		t.Errorf("ParseRecipient(identity): got %v, want %v", err, ErrBadRecipient)
+	}
+	if _, err := ParseIdentity(testRecipient); !errors.Is(err, ErrBadIdentity) {
+		t.Errorf("ParseIdentity(recipient): got %v, want %v", err, ErrBadIdentity)
+	}
+}
+
+// TestBech32 checks the codec against the valid checksums of BIP 173.
+func TestBech32(t *testing.T) {
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	} {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("bech32Decode(%s): %v", s, err)
+		}
+	}
+	for _, s := range []string{"A12uEL5L", "a12uel5m", "pzry9x0s0muk", "1pzry9x0s0muk"} {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("bech32Decode(%s): no error", s)
+		}
+	}
+}
+
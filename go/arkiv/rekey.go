@@ -0,0 +1,122 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Rekey writes to out a copy of this archive encrypted with newPassword.
+// Every encrypted member (*.aes) is decrypted with the current password
+// and encrypted again with the new one, one member at a time, without
+// being decompressed; other members are copied as is, except kdf.zst which
+// gets a new salt for the new master key (its parameters are kept). The
+// prefix is kept, so member names and hashes do not change. Incremental
+// archives are refused: their base would no longer open with the new
+// password. So are archives encrypted for recipients, which have no
+// password. When a member cannot be re-encrypted, out is removed.
+func (a *ArchiveReader) Rekey(out string, newPassword []byte) error {
+	f, members, err := a.openMembers()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if a.base != nil {
+		return fmt.Errorf("%w: %s is incremental, its base would no longer open with the new password", ErrBadBase, a.path)
+	}
+	if a.kdf != nil && a.kdf.name == kdfX25519 {
+		return fmt.Errorf("%w: %s is encrypted for recipients, it has no password", ErrBadKDF, a.path)
+	}
+	if isSameFile(f, out) {
+		return fmt.Errorf("%s is the archive being rekeyed", out)
+	}
+
+	var newKDF *kdfParams
+	var newCipher memberCipher
+	if a.kdf != nil {
+		if newKDF, err = a.kdf.renewed(); err != nil {
+			return err
+		}
+		master, err := newKDF.masterKey(newPassword, nil)
+		if err != nil {
+			return err
+		}
+		defer clear(master)
+		newCipher = a.format.newMasterCipher(master)
+	} else if newCipher, err = a.format.newCipher(newPassword); err != nil {
+		return err
+	}
+	o, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	// A failure leaves no partial archive behind.
+	abort := func(err error) error {
+		o.Close()
+		os.Remove(out)
+		return err
+	}
+	tw := tar.NewWriter(o)
+	for _, m := range members.members {
+		r := memberReader(f, m)
+		if m.name == kdfMember && newKDF != nil {
+			r, m.size, err = kdfMemberReader(*newKDF)
+			if err != nil {
+				return abort(err)
+			}
+		}
+		if err := a.rekeyMember(tw, r, m, newCipher); err != nil {
+			return abort(fmt.Errorf("%s: %w", m.name, err))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return abort(err)
+	}
+	if err := o.Close(); err != nil {
+		os.Remove(out)
+		return err
+	}
+	return nil
+}
+
+// rekeyMember writes the member m, read from r, to tw, encrypting it with
+// newCipher. In every format the ciphertext size only depends on the
+// plaintext size, so an encrypted member keeps its size and can be
+// streamed without spooling; a corrupted member is reported by the tar
+// writer as a size mismatch.
+func (a *ArchiveReader) rekeyMember(tw *tar.Writer, r io.Reader, m member, newCipher memberCipher) error {
+	hdr := &tar.Header{Name: m.name, Mode: 0600, Size: m.size}
+	switch {
+	case strings.HasSuffix(m.name, "/"):
+		// Directory entries written by the shell tools.
+		hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		return tw.WriteHeader(hdr)
+	case !strings.HasSuffix(m.name, ".aes"):
+		hdr.Mode = 0644
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	dr, err := a.cipher.decryptReader(r, m.name)
+	if err != nil {
+		return err
+	}
+	ew, err := newCipher.encryptWriter(tw, m.name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ew, dr); err != nil {
+		ew.Close()
+		return err
+	}
+	return ew.Close()
+}
+
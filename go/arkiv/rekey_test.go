@@ -0,0 +1,39 @@
+package arkiv
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRekeyCorrupted checks that Rekey leaves no archive behind when a
+// member of its input does not decrypt.
+func TestRekeyCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "a.arkiv")
+	w := NewArchiveWriter(in, []byte("secret"))
+	err := w.CreateFS(fstest.MapFS{"gen/a.txt": {Data: []byte("abcde")}}, []string{"gen"})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("CreateFS: %v", err)
+	}
+
+	// Change the last byte of the data member, in its authentication tag.
+	flipLastByte(t, in, "data/")
+
+	out := filepath.Join(dir, "b.arkiv")
+	r := NewArchiveReader(in, []byte("secret"))
+	defer r.Close()
+	if err := r.Rekey(out, []byte("new")); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Rekey: got %v, want %v", err, ErrAuthFailed)
+	}
+	if _, err := os.Stat(out); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the failed archive was left: %v", err)
+	}
+}
+
@@ -0,0 +1,183 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"os"
+	"sync"
+)
+
+// ArchiveReader represents a read session for an Arkiv archive.
+// It encapsulates the archive path, password, and lazily loaded state
+// like the PREFIX_BASE64 and the parsed textual index. It also implements
+// fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS over the archive.
+type ArchiveReader struct {
+	path      string
+	password  []byte
+	prefixB64 string
+	format    *Format
+	kdf       *kdfParams
+	master    []byte
+	cipher    memberCipher
+	index     *Index
+	members   *memberTable
+	opts      ReaderOptions
+	loadMu    sync.Mutex // guards the loading of the fields above
+	mu        sync.Mutex // guards tree
+	tree      *fsTree
+
+	// Base archive of an incremental archive.
+	base         *baseInfo
+	baseMu       sync.Mutex
+	parentReader *ArchiveReader
+}
+
+// NewArchiveReader creates a new reader session for the given archive path
+// and password. It does not immediately read the archive; loading is lazy.
+func NewArchiveReader(path string, password []byte) *ArchiveReader {
+	return &ArchiveReader{path: path, password: password}
+}
+
+// NewArchiveReaderWithOptions is like NewArchiveReader but applies the
+// given options to the session.
+func NewArchiveReaderWithOptions(path string, password []byte, opts ReaderOptions) *ArchiveReader {
+	return &ArchiveReader{path: path, password: password, opts: opts}
+}
+
+// ensureLoaded lazily initializes prefixB64 and the textual index. It
+// loads the member table of the archive (from its sidecar, or by walking
+// the tar headers), then reads the magic, prefix and index.zst.aes members.
+// It is safe for concurrent use.
+func (a *ArchiveReader) ensureLoaded() error {
+	a.loadMu.Lock()
+	defer a.loadMu.Unlock()
+	// If already loaded, nothing to do.
+	if a.index != nil && a.prefixB64 != "" {
+		return nil
+	}
+
+	// Open the archive and locate its members.
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	members, err := a.loadMembers(f)
+	if err != nil {
+		return err
+	}
+
+	// Validate the magic, key derivation and prefix members.
+	h, err := readHeader(f, members, a.password, a.opts.Identities)
+	if err != nil {
+		return err
+	}
+
+	// Parse index.zst.aes.
+	idx, err := readIndex(f, members, h.format, h.cipher)
+	if err != nil {
+		return err
+	}
+
+	// Read base.zst.aes, present in incremental archives.
+	var base *baseInfo
+	if m, ok := members.lookup(baseMember); ok {
+		if base, err = readBaseInfo(f, m, h.cipher); err != nil {
+			return err
+		}
+	}
+
+	// Cache for subsequent operations.
+	a.base = base
+	a.format = h.format
+	a.kdf = h.kdf
+	a.master = h.master
+	a.cipher = h.cipher
+	a.members = members
+	a.prefixB64 = h.prefixB64
+	a.index = idx
+	return nil
+}
+
+// Index returns the parsed textual index of the archive, loading it on
+// first use. The returned value is shared with the session and must not
+// be modified.
+func (a *ArchiveReader) Index() (*Index, error) {
+	if err := a.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return a.index, nil
+}
+
+// Close attempts to securely wipe the password and master key bytes,
+// including those of the base archives opened for an incremental archive.
+// It does not close any files (they are managed per method).
+func (a *ArchiveReader) Close() {
+	if a.parentReader != nil {
+		a.parentReader.Close()
+	}
+	for _, b := range [][]byte{a.password, a.master} {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+}
+
+// ArchiveWriter represents a write session for creating Arkiv archives.
+// It encapsulates the destination path and the password used for
+// encryption, plus the state of the archive being written: entries are
+// added one at a time (Create, CreateFS or AddFile, AddDir, ...) and the
+// index is written when the session is finished.
+type ArchiveWriter struct {
+	path        string
+	password    []byte
+	f           *os.File
+	tw          *tar.Writer
+	prefixB64   string
+	format      *Format
+	kdf         *kdfParams
+	master      []byte
+	cipher      memberCipher
+	idx         Index
+	dataWritten map[string]bool
+	baseData    map[string]bool
+	storedSizes map[int64]bool
+	stats       Stats
+	added       map[string]bool
+	finished    bool
+	err         error // first failed addition, see fail
+	opts        WriterOptions
+}
+
+// NewArchiveWriter constructs a writer session for a target archive path
+// and password. The archive file is created when the first entry is added.
+func NewArchiveWriter(path string, password []byte) *ArchiveWriter {
+	return &ArchiveWriter{path: path, password: password}
+}
+
+// NewArchiveWriterWithOptions is like NewArchiveWriter but applies the
+// given options to the session.
+func NewArchiveWriterWithOptions(path string, password []byte, opts WriterOptions) *ArchiveWriter {
+	return &ArchiveWriter{path: path, password: password, opts: opts}
+}
+
+// Close writes index.zst.aes and closes the archive if entries were added
+// since it was last finished, then attempts to securely wipe the password
+// and master key bytes. Further additions fail with ErrClosed. After a
+// failed addition the archive is incomplete: Close removes it instead.
+func (w *ArchiveWriter) Close() error {
+	var err error
+	switch {
+	case w.err != nil:
+		err = w.abort()
+	case w.tw != nil:
+		err = w.finish()
+	}
+	w.finished = true
+	for _, b := range [][]byte{w.password, w.master} {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+	return err
+}
+
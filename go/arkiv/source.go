@@ -0,0 +1,129 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ReadLinkFS is implemented by file systems that expose symbolic links.
+// Its method set matches fs.ReadLinkFS of recent Go releases. When the
+// file system given to CreateFS implements it, symlinks are archived as
+// such instead of being followed.
+type ReadLinkFS interface {
+	fs.FS
+	// ReadLink returns the destination of the named symbolic link.
+	ReadLink(name string) (string, error)
+	// Lstat returns information about the named file without following
+	// a final symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// OwnerInfo may be implemented by the value returned by fs.FileInfo.Sys()
+// to provide the numeric owner of a file. *tar.Header and the host
+// *syscall.Stat_t are recognized as well.
+type OwnerInfo interface {
+	Uid() int
+	Gid() int
+}
+
+// source abstracts the file tree an archive is created from: the host
+// file system or any fs.FS.
+type source interface {
+	// walk calls fn for root and, when root is a directory that is not a
+	// symlink, for all its descendants.
+	walk(root string, fn func(p string) error) error
+	// lstat returns information about p without following symlinks.
+	lstat(p string) (fs.FileInfo, error)
+	// readlink returns the target of the symlink p.
+	readlink(p string) (string, error)
+	// open opens the regular file p for reading.
+	open(p string) (io.ReadCloser, error)
+}
+
+// hostSource reads host paths through the os package.
+type hostSource struct{}
+
+// walk visits host paths with filepath.WalkDir (symlinks are not followed).
+func (hostSource) walk(root string, fn func(p string) error) error {
+	return filepath.WalkDir(root, func(p string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		return fn(p)
+	})
+}
+
+// lstat calls os.Lstat.
+func (hostSource) lstat(p string) (fs.FileInfo, error) {
+	return os.Lstat(p)
+}
+
+// readlink calls os.Readlink.
+func (hostSource) readlink(p string) (string, error) {
+	return os.Readlink(p)
+}
+
+// open calls os.Open.
+func (hostSource) open(p string) (io.ReadCloser, error) {
+	return os.Open(p)
+}
+
+// fsSource reads slash-separated names from an fs.FS.
+type fsSource struct {
+	fsys fs.FS
+}
+
+// walk visits names with fs.WalkDir. A root that is not a directory (as
+// seen by lstat) is visited alone, so a symlinked root is not followed.
+func (s fsSource) walk(root string, fn func(p string) error) error {
+	fi, err := s.lstat(root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fn(root)
+	}
+	return fs.WalkDir(s.fsys, root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		return fn(p)
+	})
+}
+
+// lstat uses ReadLinkFS.Lstat when available, fs.Stat otherwise.
+func (s fsSource) lstat(p string) (fs.FileInfo, error) {
+	if rl, ok := s.fsys.(ReadLinkFS); ok {
+		return rl.Lstat(p)
+	}
+	return fs.Stat(s.fsys, p)
+}
+
+// readlink requires the file system to implement ReadLinkFS.
+func (s fsSource) readlink(p string) (string, error) {
+	if rl, ok := s.fsys.(ReadLinkFS); ok {
+		return rl.ReadLink(p)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: p, Err: fs.ErrInvalid}
+}
+
+// open calls fs.FS.Open.
+func (s fsSource) open(p string) (io.ReadCloser, error) {
+	return s.fsys.Open(p)
+}
+
+// fileOwner returns the numeric owner of a file from its Sys() value,
+// falling back to 0:0 when it is unknown.
+func fileOwner(fi fs.FileInfo) (uid, gid int) {
+	switch sys := fi.Sys().(type) {
+	case *tar.Header:
+		return sys.Uid, sys.Gid
+	case OwnerInfo:
+		return sys.Uid(), sys.Gid()
+	}
+	return getUID(fi), getGID(fi)
+}
+
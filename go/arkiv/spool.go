@@ -0,0 +1,96 @@
+package arkiv
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// spoolMemLimit is the amount of data a spool keeps in memory before
+// moving it to a temporary file.
+const spoolMemLimit = 4 << 20
+
+// spool buffers bytes whose total size must be known before they can be
+// written (tar headers carry the member size). Small contents stay in
+// memory; bigger ones are moved to a temporary file so that memory use
+// does not depend on the size of the archived files.
+type spool struct {
+	dir  string
+	mem  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+// newSpool returns an empty spool whose temporary file, if any, is created
+// in dir (the default temporary directory when empty).
+func newSpool(dir string) *spool {
+	return &spool{dir: dir}
+}
+
+// Write appends p to the spool.
+func (s *spool) Write(p []byte) (int, error) {
+	if s.file == nil && s.mem.Len()+len(p) > spoolMemLimit {
+		f, err := os.CreateTemp(s.dir, "arkiv-spool-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := s.file.Write(s.mem.Bytes()); err != nil {
+			return 0, err
+		}
+		s.mem = bytes.Buffer{}
+	}
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.mem.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes written so far.
+func (s *spool) Size() int64 {
+	return s.size
+}
+
+// WriteTo copies the spooled bytes to w.
+func (s *spool) WriteTo(w io.Writer) (int64, error) {
+	if s.file == nil {
+		return s.mem.WriteTo(w)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, s.file)
+}
+
+// Reader returns a reader over the spooled bytes, from the start. The
+// spool must not be written to while the reader is in use.
+func (s *spool) Reader() (io.Reader, error) {
+	if s.file == nil {
+		return bytes.NewReader(s.mem.Bytes()), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s.file, nil
+}
+
+// Close releases the spooled bytes and removes the temporary file.
+func (s *spool) Close() error {
+	s.mem = bytes.Buffer{}
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	err := s.file.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	s.file = nil
+	return err
+}
+
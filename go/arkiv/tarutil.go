@@ -0,0 +1,158 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+)
+
+// archiveHeader holds what the header members of an archive tell: its
+// format version, the settings of its master key and the master key (nil
+// unless the format has one), the cipher of its members and its
+// PREFIX_BASE64.
+type archiveHeader struct {
+	format    *Format
+	kdf       *kdfParams
+	master    []byte
+	cipher    memberCipher
+	prefixB64 string
+}
+
+// readHeader reads the first members of the outer tar:
+//   1) magic.zst (must decompress to the magic of a supported format)
+//   2) kdf.zst, for the formats with a master key
+//   3) prefix.zst.aes (encrypted → zstd → 8 random bytes → base64 string)
+//
+// The master key of an archive encrypted for recipients is unwrapped with
+// identities instead of being derived from password.
+func readHeader(f *os.File, t *memberTable, password []byte, identities []*Identity) (*archiveHeader, error) {
+	// 1) Expect and validate magic.zst.
+	if len(t.members) < 1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if name := t.members[0].name; name != "magic.zst" {
+		return nil, fmt.Errorf("%w: expected magic.zst, got %s", ErrUnexpectedMember, name)
+	}
+
+	// Decompress the payload and look up its format version.
+	zdecMagic, err := NewZstdDecoder(memberReader(f, t.members[0]))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := io.ReadAll(zdecMagic)
+	zdecMagic.Close()
+	if err != nil {
+		return nil, err
+	}
+	format, ok := lookupFormat(string(payload))
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrBadMagic, payload)
+	}
+	h := &archiveHeader{format: format}
+	next := 1
+
+	// 2) Read the settings of the master key.
+	if format.MasterKey {
+		if len(t.members) <= next {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if name := t.members[next].name; name != kdfMember {
+			return nil, fmt.Errorf("%w: expected %s, got %s", ErrUnexpectedMember, kdfMember, name)
+		}
+		if h.kdf, err = readKDFParams(f, t.members[next]); err != nil {
+			return nil, err
+		}
+		if h.master, err = h.kdf.masterKey(password, identities); err != nil {
+			return nil, err
+		}
+		h.cipher = format.newMasterCipher(h.master)
+		next++
+	} else if h.cipher, err = format.newCipher(password); err != nil {
+		return nil, err
+	}
+
+	// 3) Read prefix.zst.aes and convert to base64 string.
+	if len(t.members) <= next {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if name := t.members[next].name; name != "prefix.zst.aes" {
+		return nil, fmt.Errorf("%w: expected prefix.zst.aes, got %s", ErrUnexpectedMember, name)
+	}
+
+	// The prefix is the first encrypted member: a well-formed ciphertext
+	// (salt or OpenSSL header, whole blocks or tag) that fails to decrypt
+	// or decompress means the password is wrong. Anything else is
+	// corruption.
+	m := t.members[next]
+	dr, err := h.cipher.decryptReader(memberReader(f, m), m.name)
+	if err != nil {
+		return nil, fmt.Errorf("prefix.zst.aes: %w", err)
+	}
+	if !h.cipher.wellFormed(m.size) {
+		return nil, fmt.Errorf("%w: truncated ciphertext of %d bytes", ErrBadPrefix, m.size)
+	}
+	zdecPrefix, err := NewZstdDecoder(dr)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	b8, err := io.ReadAll(zdecPrefix)
+	zdecPrefix.Close()
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	if len(b8) != 8 {
+		return nil, fmt.Errorf("%w: payload must be 8 bytes, got %d", ErrBadPrefix, len(b8))
+	}
+	h.prefixB64 = prefixBytesToBase64(b8)
+	return h, nil
+}
+
+// readIndex looks up "index.zst.aes" in the member table, then decrypts
+// and parses it into an Index structure with the codecs of format.
+func readIndex(f *os.File, t *memberTable, format *Format, c memberCipher) (*Index, error) {
+	m, ok := t.lookup("index.zst.aes")
+	if !ok {
+		return nil, ErrMissingIndex
+	}
+	// The password was checked with the prefix: errors are corruption.
+	dr, err := c.decryptReader(memberReader(f, m), m.name)
+	if err != nil {
+		return nil, fmt.Errorf("index.zst.aes: %w", err)
+	}
+	zdec, err := NewZstdDecoder(dr)
+	if err != nil {
+		return nil, fmt.Errorf("index.zst.aes: %w", err)
+	}
+	defer zdec.Close()
+	idx, err := format.parseIndex(zdec)
+	if err != nil {
+		return nil, fmt.Errorf("index.zst.aes: %w", err)
+	}
+	return idx, nil
+}
+
+// decodeMeta decrypts and decompresses the meta member name, read from r,
+// of the index path raw and returns the header of the single entry of its
+// inner tar. A header naming another path means the member was replaced
+// by the meta member of another entry: ErrUnexpectedMember.
+func decodeMeta(r io.Reader, c memberCipher, name, raw string) (*tar.Header, error) {
+	dr, err := c.decryptReader(r, name)
+	if err != nil {
+		return nil, err
+	}
+	zdec, err := NewZstdDecoder(dr)
+	if err != nil {
+		return nil, err
+	}
+	defer zdec.Close()
+	mh, err := tar.NewReader(zdec).Next()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if !sameMetaPath(mh.Name, raw) {
+		return nil, fmt.Errorf("%w: %s holds path %q instead of %q", ErrUnexpectedMember, name, mh.Name, raw)
+	}
+	return mh, nil
+}
+
@@ -0,0 +1,32 @@
+package arkiv
+
+import (
+	"crypto/sha512"
+	"hash"
+)
+
+// Constants for the Arkiv format and environment variables.
+const (
+	MagicString = "arkiv001"
+	// MagicAEAD identifies the format whose members are encrypted with
+	// chunked AES-256-GCM instead of AES-256-CBC.
+	MagicAEAD = "arkiv002"
+	// MagicMasterKey identifies the format whose members are encrypted
+	// with AES-256-GCM under subkeys of one master key per archive.
+	MagicMasterKey = "arkiv003"
+	EnvPass        = "ARKIV_PASS"
+	// EnvNewPass holds the new password of the rekey command.
+	EnvNewPass = "ARKIV_NEW_PASS"
+	// MemberIndexSuffix is appended to an archive path to name its member
+	// index sidecar, written by ArchiveReader.Reindex.
+	MemberIndexSuffix = ".idx"
+)
+
+// NewSHA512_256 constructs a SHA-512/256 hasher and return it as a
+// generic hash.Hash. Returning the interface avoids relying on any
+// unexported concrete type from crypto/sha512.
+func NewSHA512_256() hash.Hash {
+	// Note: type assertion is safe for crypto/sha512 implementation.
+	return sha512.New512_256()
+}
+
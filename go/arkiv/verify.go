@@ -0,0 +1,216 @@
+package arkiv
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// Kinds of the problems found by Verify.
+const (
+	// ProblemMissingMeta: an indexed path has no meta member.
+	ProblemMissingMeta = "missing-meta"
+	// ProblemMissingData: a regular file has no data member.
+	ProblemMissingData = "missing-data"
+	// ProblemOrphan: a member is not referenced by the index.
+	ProblemOrphan = "orphan"
+	// ProblemDuplicate: a member name or an indexed path appears twice.
+	ProblemDuplicate = "duplicate"
+	// ProblemHashMismatch: the hash recomputed from a member does not
+	// match its name (SHA-512/256 of the prefix and the path or content).
+	ProblemHashMismatch = "hash-mismatch"
+	// ProblemUnreadable: a member cannot be decrypted or decompressed.
+	ProblemUnreadable = "unreadable"
+	// ProblemBadBase: the base archive of an incremental archive, or one
+	// of its own bases, is missing or is not the one recorded.
+	ProblemBadBase = "bad-base"
+)
+
+// VerifyProblem is one integrity problem found by Verify. Member is the
+// name of the outer tar member concerned and Path the indexed path, when
+// they apply.
+type VerifyProblem struct {
+	Kind   string `json:"kind"`
+	Member string `json:"member,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// String formats the problem on one line.
+func (p VerifyProblem) String() string {
+	s := p.Kind
+	if p.Member != "" {
+		s += " " + p.Member
+	}
+	if p.Path != "" {
+		s += " \"" + p.Path + "\""
+	}
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	return s
+}
+
+// VerifyReport is the result of Verify. It can be encoded as JSON.
+type VerifyReport struct {
+	Members     int             `json:"members"`
+	Entries     int             `json:"entries"`
+	MetaMembers int             `json:"meta_members"`
+	DataMembers int             `json:"data_members"`
+	Base        string          `json:"base,omitempty"`
+	Problems    []VerifyProblem `json:"problems"`
+}
+
+// OK reports whether no problem was found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// add records a problem.
+func (r *VerifyReport) add(kind, member, path, detail string) {
+	r.Problems = append(r.Problems, VerifyProblem{Kind: kind, Member: member, Path: path, Detail: detail})
+}
+
+// Verify checks the integrity of the whole archive: magic.zst, the prefix
+// and the index are validated, every member is decrypted and decompressed,
+// meta members must hold the path whose hash names them and data hashes
+// are recomputed from the content. For an incremental archive, the data
+// members it omits must exist in its chain of base archives (they are not
+// rehashed there; verify the bases themselves for that). Integrity
+// problems are collected in the report; the error is only set when the
+// archive cannot be read at all (not an Arkiv archive, wrong password,
+// missing index, I/O error).
+func (a *ArchiveReader) Verify() (*VerifyReport, error) {
+	// Validate magic, prefix and index.
+	f, members, err := a.openMembers()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rep := &VerifyReport{Members: len(members.members), Entries: len(a.index.Entries), Problems: []VerifyProblem{}}
+
+	// --- Expected members, from the index ---
+	metaPaths := make(map[string]string, len(a.index.Entries))
+	dataPaths := make(map[string][]string)
+	seenPaths := make(map[string]bool, len(a.index.Entries))
+	for _, e := range a.index.Entries {
+		if seenPaths[e.PathRaw] {
+			rep.add(ProblemDuplicate, "index.zst.aes", e.PathRaw, "path indexed twice")
+			continue
+		}
+		seenPaths[e.PathRaw] = true
+		metaPaths[a.format.metaMemberName(a.prefixB64, e.PathRaw)] = e.PathRaw
+		if e.HashData != "" {
+			name := dataMemberName(e.HashData)
+			dataPaths[name] = append(dataPaths[name], e.PathRaw)
+		}
+	}
+
+	// --- Walk every member ---
+	seen := make(map[string]bool, len(members.members))
+	for _, m := range members.members {
+		if seen[m.name] {
+			rep.add(ProblemDuplicate, m.name, "", "member stored twice")
+		}
+		seen[m.name] = true
+
+		switch {
+		case m.name == "magic.zst" || m.name == kdfMember || m.name == "prefix.zst.aes" || m.name == "index.zst.aes" || m.name == baseMember:
+			// Validated when loading the archive.
+
+		case m.name == "meta/" || m.name == "data/":
+			// Directory entries written by the shell tools.
+
+		case metaPaths[m.name] != "":
+			rep.MetaMembers++
+			raw := metaPaths[m.name]
+			_, err := decodeMeta(memberReader(f, m), a.cipher, m.name, raw)
+			switch {
+			case errors.Is(err, ErrUnexpectedMember):
+				rep.add(ProblemHashMismatch, m.name, raw, err.Error())
+			case err != nil:
+				rep.add(ProblemUnreadable, m.name, raw, err.Error())
+			}
+
+		case dataPaths[m.name] != nil:
+			rep.DataMembers++
+			raw := dataPaths[m.name][0]
+			hash, err := a.hashDataMember(f, m)
+			if err != nil {
+				rep.add(ProblemUnreadable, m.name, raw, err.Error())
+				continue
+			}
+			if got := dataMemberName(hash); got != m.name {
+				rep.add(ProblemHashMismatch, m.name, raw, "content hash is "+hash)
+			}
+
+		default:
+			rep.add(ProblemOrphan, m.name, "", "")
+		}
+	}
+
+	// --- Base archives of an incremental archive ---
+	// Data members omitted from this archive must be found in the chain.
+	// A broken link is reported once; the bases before it are still
+	// searched.
+	if a.base != nil {
+		rep.Base = a.resolveBasePath()
+	}
+	badBase := false
+	inChain := func(name string) bool {
+		if a.base == nil {
+			return false
+		}
+		ok, err := a.chainHasData(name)
+		if err != nil && !badBase {
+			rep.add(ProblemBadBase, baseMember, "", err.Error())
+			badBase = true
+		}
+		return ok
+	}
+
+	// --- Indexed paths without their members ---
+	for i, e := range a.index.Entries {
+		if i > 0 && a.index.Entries[i-1].PathRaw == e.PathRaw {
+			continue
+		}
+		if name := a.format.metaMemberName(a.prefixB64, e.PathRaw); !seen[name] {
+			rep.add(ProblemMissingMeta, name, e.PathRaw, "")
+		}
+		if e.HashData == "" {
+			continue
+		}
+		if name := dataMemberName(e.HashData); !seen[name] && !inChain(name) {
+			rep.add(ProblemMissingData, name, e.PathRaw, "")
+		}
+	}
+	return rep, nil
+}
+
+// sameMetaPath reports whether the inner tar entry of a meta member, named
+// name, is the indexed path raw. The shell tools strip the leading "/" and
+// tar adds a "/" to directory names, so both are normalized first.
+func sameMetaPath(name, raw string) bool {
+	norm := func(p string) string {
+		return strings.TrimPrefix(path.Clean("/"+unescapeIndexPath(p)), "/")
+	}
+	return norm(name) == norm(raw)
+}
+
+// hashDataMember decrypts and decompresses the data member m and returns
+// the HASH_DATA of its content.
+func (a *ArchiveReader) hashDataMember(f *os.File, m member) (string, error) {
+	dr, err := a.cipher.decryptReader(memberReader(f, m), m.name)
+	if err != nil {
+		return "", err
+	}
+	zdec, err := NewZstdDecoder(dr)
+	if err != nil {
+		return "", err
+	}
+	defer zdec.Close()
+	return a.format.dataHash(a.prefixB64, zdec)
+}
+
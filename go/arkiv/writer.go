@@ -0,0 +1,521 @@
+package arkiv
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Meta holds the attributes stored in the meta member of an entry added
+// with AddFile, AddDir, AddSymlink or AddFifo. Only the permission bits of
+// Mode are kept; ModTime is stored in UTC.
+type Meta struct {
+	Mode    fs.FileMode
+	Uid     int
+	Gid     int
+	ModTime time.Time
+}
+
+// Stats reports the regular file contents handled by a write session.
+type Stats struct {
+	// Files is the number of regular files added.
+	Files int
+	// Bytes is the total size of their contents.
+	Bytes int64
+	// StoredFiles is the number of data members written.
+	StoredFiles int
+	// StoredBytes is the total raw size of the data members written.
+	StoredBytes int64
+	// DedupFiles is the number of files whose content was already stored.
+	DedupFiles int
+	// DedupBytes is the raw size saved by deduplication.
+	DedupBytes int64
+}
+
+// AddFile adds a regular file whose content is read from r until EOF.
+// Its data member is written only if no identical content was added
+// before (deduplication by HASH_DATA). When r is an io.ReadSeeker and a
+// content of the same size was already stored, r is hashed first and
+// duplicates are neither compressed nor encrypted.
+func (w *ArchiveWriter) AddFile(path string, r io.Reader, meta Meta) error {
+	return w.fail(w.addEntry(path, &tar.Header{Typeflag: tar.TypeReg}, meta, r))
+}
+
+// AddDir adds a directory. Its content must be added separately.
+func (w *ArchiveWriter) AddDir(path string, meta Meta) error {
+	return w.fail(w.addEntry(path, &tar.Header{Typeflag: tar.TypeDir}, meta, nil))
+}
+
+// AddSymlink adds a symbolic link pointing to target.
+func (w *ArchiveWriter) AddSymlink(path string, target string, meta Meta) error {
+	return w.fail(w.addEntry(path, &tar.Header{Typeflag: tar.TypeSymlink, Linkname: target}, meta, nil))
+}
+
+// AddFifo adds a named pipe.
+func (w *ArchiveWriter) AddFifo(path string, meta Meta) error {
+	return w.fail(w.addEntry(path, &tar.Header{Typeflag: tar.TypeFifo}, meta, nil))
+}
+
+// fail records err, if any, as the first failure of the session and
+// returns it. The archive may then hold partial members: further
+// additions return the recorded error, and Close removes the archive
+// instead of finishing it.
+func (w *ArchiveWriter) fail(err error) error {
+	if err != nil && w.err == nil && !w.finished {
+		w.err = err
+	}
+	return err
+}
+
+// abort closes and removes the archive file after a failed addition.
+func (w *ArchiveWriter) abort() error {
+	if w.finished {
+		return nil
+	}
+	w.finished = true
+	if w.f == nil {
+		return nil
+	}
+	w.f.Close()
+	return os.Remove(w.path)
+}
+
+// begin creates the archive file and writes magic.zst and prefix.zst.aes
+// the first time an entry is added.
+func (w *ArchiveWriter) begin() error {
+	if w.finished {
+		return ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.tw != nil {
+		return nil
+	}
+
+	if err := w.selectFormat(); err != nil {
+		return err
+	}
+
+	// Load the base archive of an incremental archive first: it may be
+	// the file about to be truncated.
+	var prefixRaw []byte
+	var base *baseInfo
+	if w.opts.Base != "" {
+		var err error
+		if prefixRaw, base, err = w.openBase(); err != nil {
+			return err
+		}
+	}
+	return w.start(prefixRaw, base)
+}
+
+// selectFormat looks up the format version of WriterOptions.Format and
+// its cipher, once. A format with a master key gets new key derivation
+// settings, selected by WriterOptions.KDF, or a random master key wrapped
+// for WriterOptions.Recipients, unless they were set beforehand.
+func (w *ArchiveWriter) selectFormat() error {
+	if w.format != nil {
+		return nil
+	}
+	recipients := len(w.opts.Recipients) > 0
+	magic := w.opts.Format
+	if magic == "" {
+		magic = DefaultFormat
+	}
+	format, ok := lookupFormat(magic)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownFormat, magic)
+	}
+	if !format.MasterKey {
+		if recipients {
+			return fmt.Errorf("%w: format %s has no master key to wrap", ErrBadRecipient, magic)
+		}
+		if w.opts.KDF != (KDFOptions{}) {
+			return fmt.Errorf("%w: format %s derives a key for every member", ErrBadKDF, magic)
+		}
+		c, err := format.newCipher(w.password)
+		if err != nil {
+			return err
+		}
+		w.format = format
+		w.cipher = c
+		return nil
+	}
+
+	var err error
+	switch {
+	case w.kdf != nil:
+	case recipients && w.opts.KDF != (KDFOptions{}):
+		return fmt.Errorf("%w: the master key of an archive encrypted for recipients is random", ErrBadKDF)
+	case recipients && w.opts.Base != "":
+		return fmt.Errorf("%w: an archive encrypted for recipients cannot read its base", ErrBadBase)
+	case recipients:
+		if w.kdf, w.master, err = newRecipientParams(w.opts.Recipients); err != nil {
+			return err
+		}
+	default:
+		if w.kdf, err = newKDFParams(w.opts.KDF); err != nil {
+			return err
+		}
+	}
+	if w.master == nil {
+		if w.master, err = w.kdf.masterKey(w.password, nil); err != nil {
+			return err
+		}
+	}
+	w.format = format
+	w.cipher = format.newMasterCipher(w.master)
+	return nil
+}
+
+// start creates the archive file and writes its header members: magic.zst,
+// kdf.zst for the formats with a master key, prefix.zst.aes with prefixRaw
+// (random when nil) and, when base is set, base.zst.aes.
+func (w *ArchiveWriter) start(prefixRaw []byte, base *baseInfo) error {
+	if err := w.selectFormat(); err != nil {
+		return err
+	}
+
+	// Create (or truncate) the destination archive file.
+	f, err := os.Create(w.path)
+	if err != nil {
+		return err
+	}
+
+	// Prepare tar writer for the outer container.
+	w.f = f
+	w.tw = tar.NewWriter(f)
+	w.dataWritten = make(map[string]bool)
+	for hData := range w.baseData {
+		w.dataWritten[hData] = true
+	}
+	w.storedSizes = make(map[int64]bool)
+	w.added = make(map[string]bool)
+
+	// --- Write magic.zst (zstd of the format, unencrypted) ---
+	var magicBuf bytes.Buffer
+	zwMagic, err := NewZstdEncoder(&magicBuf)
+	if err != nil {
+		return err
+	}
+	if _, err := zwMagic.Write([]byte(w.format.Magic)); err != nil {
+		zwMagic.Close()
+		return err
+	}
+	if err := zwMagic.Close(); err != nil {
+		return err
+	}
+	if err := w.writeMember("magic.zst", 0644, magicBuf.Bytes()); err != nil {
+		return err
+	}
+
+	// --- Write kdf.zst (zstd of the key derivation settings) ---
+	if w.kdf != nil {
+		kdf, err := compressKDFParams(*w.kdf)
+		if err != nil {
+			return err
+		}
+		if err := w.writeMember(kdfMember, 0644, kdf); err != nil {
+			return err
+		}
+	}
+
+	// --- Write prefix.zst.aes: 8 random bytes → zstd → encryption ---
+	if prefixRaw == nil {
+		prefixRaw = make([]byte, 8)
+		if _, err := io.ReadFull(rand.Reader, prefixRaw); err != nil {
+			return err
+		}
+	}
+	w.prefixB64 = base64.StdEncoding.EncodeToString(prefixRaw)
+	if err := w.writeEncrypted("prefix.zst.aes", prefixRaw); err != nil {
+		return err
+	}
+
+	// --- Write base.zst.aes for incremental archives ---
+	if base == nil {
+		return nil
+	}
+	return w.writeEncrypted(baseMember, encodeBaseInfo(*base))
+}
+
+// addEntry writes the meta member of one path and, for regular files, the
+// data member streamed from content, then records the index entry.
+func (w *ArchiveWriter) addEntry(path string, hdr *tar.Header, meta Meta, content io.Reader) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	if w.added[path] {
+		return fmt.Errorf("%w: %s", ErrDuplicatePath, path)
+	}
+	w.added[path] = true
+
+	// Build index entry (quoted path string and raw substring).
+	quoted, raw := escapeForIndex(path)
+	entry := IndexEntry{PathRaw: raw, Quoted: quoted}
+
+	// Compress + encrypt the meta tar and write into the outer tar.
+	metaTar, err := buildMetaTar(raw, hdr, meta)
+	if err != nil {
+		return err
+	}
+	if err := w.writeEncrypted(w.format.metaMemberName(w.prefixB64, raw), metaTar); err != nil {
+		return err
+	}
+
+	// For regular files, stream and write data/<HASH_DATA>.zst.aes once.
+	if hdr.Typeflag == tar.TypeReg {
+		hData, err := w.addData(content)
+		if err != nil {
+			return err
+		}
+		entry.HashData = hData
+	}
+
+	// Add the entry to the textual index.
+	w.idx.Entries = append(w.idx.Entries, entry)
+	return nil
+}
+
+// Stats returns the content statistics of the session so far.
+func (w *ArchiveWriter) Stats() Stats {
+	return w.stats
+}
+
+// buildMetaTar creates the one-entry tar carrying the metadata of raw.
+// hdr holds the type and link target; it is completed from meta.
+func buildMetaTar(raw string, hdr *tar.Header, meta Meta) ([]byte, error) {
+	hdr.Name = raw // exact raw path between quotes
+	hdr.Mode = int64(meta.Mode.Perm())
+	hdr.Uid = meta.Uid
+	hdr.Gid = meta.Gid
+	hdr.ModTime = meta.ModTime.UTC() // store UTC
+	hdr.Size = 0                     // metadata stub only
+	var metaTar bytes.Buffer
+	mtw := tar.NewWriter(&metaTar)
+	if err := mtw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if err := mtw.Close(); err != nil {
+		return nil, err
+	}
+	return metaTar.Bytes(), nil
+}
+
+// addData returns the HASH_DATA of the content read from r and writes
+// its data member if it is new. Contents that may be duplicates (a stored
+// content has the same size, or the archive is incremental) are hashed
+// first when r can be rewound, so that known contents are not compressed
+// and encrypted again.
+func (w *ArchiveWriter) addData(r io.Reader) (string, error) {
+	size := contentSize(r)
+	if rs, ok := r.(io.ReadSeeker); ok && size >= 0 && (w.storedSizes[size] || w.baseData != nil) {
+		hData, err := w.hashContent(rs)
+		if err != nil {
+			return "", err
+		}
+		if w.dataWritten[hData] {
+			w.countData(size, false)
+			return hData, nil
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	return w.storeData(r)
+}
+
+// hashContent computes HASH_DATA = H(PREFIX_BASE64 || content).
+func (w *ArchiveWriter) hashContent(r io.Reader) (string, error) {
+	return w.format.dataHash(w.prefixB64, r)
+}
+
+// countData updates the statistics for one regular file content.
+func (w *ArchiveWriter) countData(size int64, stored bool) {
+	w.stats.Files++
+	w.stats.Bytes += size
+	if stored {
+		w.stats.StoredFiles++
+		w.stats.StoredBytes += size
+		w.storedSizes[size] = true
+	} else {
+		w.stats.DedupFiles++
+		w.stats.DedupBytes += size
+	}
+}
+
+// contentSize returns the size of the content of r when it can be known
+// without reading it (files, seekable readers), -1 otherwise.
+func contentSize(r io.Reader) int64 {
+	if st, ok := r.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if fi, err := st.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	if s, ok := r.(io.Seeker); ok {
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := s.Seek(cur, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - cur
+	}
+	return -1
+}
+
+// storeData computes HASH_DATA while streaming raw bytes from r through
+// zstd and encryption, and writes the data member if it is new.
+func (w *ArchiveWriter) storeData(r io.Reader) (string, error) {
+	hData, dataEnc, size, err := w.encryptData(r)
+	if err != nil {
+		return "", err
+	}
+	defer dataEnc.Close()
+	if err := w.writeData(hData, dataEnc, size); err != nil {
+		return "", err
+	}
+	return hData, nil
+}
+
+// encryptData streams raw bytes from r through zstd and encryption while
+// computing HASH_DATA. The encrypted blob is spooled (to a temporary file
+// when it is large) since its size must be known before the tar header is
+// written; the caller closes it. It also returns the raw content size.
+func (w *ArchiveWriter) encryptData(r io.Reader) (string, *spool, int64, error) {
+	h := w.format.newHash()
+	_, _ = h.Write([]byte(w.prefixB64))
+
+	dataEnc := newSpool(w.opts.TempDir)
+	fail := func(err error) (string, *spool, int64, error) {
+		dataEnc.Close()
+		return "", nil, 0, err
+	}
+	encW, err := w.cipher.encryptWriter(dataEnc, "data/")
+	if err != nil {
+		return fail(err)
+	}
+	zwData, err := NewZstdEncoder(encW)
+	if err != nil {
+		encW.Close()
+		return fail(err)
+	}
+	buf := make([]byte, 1<<20)
+	size, err := io.CopyBuffer(io.MultiWriter(h, zwData), r, buf)
+	if err != nil {
+		zwData.Close()
+		encW.Close()
+		return fail(err)
+	}
+	if err := zwData.Close(); err != nil {
+		encW.Close()
+		return fail(err)
+	}
+	if err := encW.Close(); err != nil {
+		return fail(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), dataEnc, size, nil
+}
+
+// writeData writes the spooled data member hData unless an identical
+// content was already written, and updates the statistics.
+func (w *ArchiveWriter) writeData(hData string, dataEnc *spool, size int64) error {
+	if w.dataWritten[hData] {
+		w.countData(size, false)
+		return nil
+	}
+	w.dataWritten[hData] = true
+	w.countData(size, true)
+	if err := w.tw.WriteHeader(&tar.Header{Name: dataMemberName(hData), Mode: 0600, Size: dataEnc.Size()}); err != nil {
+		return err
+	}
+	_, err := dataEnc.WriteTo(w.tw)
+	return err
+}
+
+// writeEncrypted compresses and encrypts plain, then writes it as the
+// named member of the outer tar.
+func (w *ArchiveWriter) writeEncrypted(name string, plain []byte) error {
+	enc, err := encryptMember(plain, name, w.cipher)
+	if err != nil {
+		return err
+	}
+	return w.writeMember(name, 0600, enc)
+}
+
+// encryptMember returns the zstd-compressed then encrypted form of plain,
+// the content of the member name.
+func encryptMember(plain []byte, name string, c memberCipher) ([]byte, error) {
+	var enc bytes.Buffer
+	encW, err := c.encryptWriter(&enc, name)
+	if err != nil {
+		return nil, err
+	}
+	zw, err := NewZstdEncoder(encW)
+	if err != nil {
+		encW.Close()
+		return nil, err
+	}
+	if _, err := zw.Write(plain); err != nil {
+		zw.Close()
+		encW.Close()
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		encW.Close()
+		return nil, err
+	}
+	if err := encW.Close(); err != nil {
+		return nil, err
+	}
+	return enc.Bytes(), nil
+}
+
+// writeMember writes one member of the outer tar.
+func (w *ArchiveWriter) writeMember(name string, mode int64, content []byte) error {
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(content))}); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(content)
+	return err
+}
+
+// finish writes index.zst.aes with sorted unique lines and closes the
+// archive file. An archive without any entry still gets its header
+// members and an empty index. When a step fails, the archive file is
+// removed.
+func (w *ArchiveWriter) finish() error {
+	if w.finished {
+		return nil
+	}
+	if err := w.begin(); err != nil {
+		return err
+	}
+	w.finished = true
+	err := w.writeEncrypted("index.zst.aes", w.format.serializeIndex(&w.idx))
+	if cerr := w.tw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// An archive without its index is useless.
+		os.Remove(w.path)
+	}
+	return err
+}
+
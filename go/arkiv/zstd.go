@@ -1,4 +1,4 @@
-package arkivformat
+package arkiv
 
 import (
 	"io"
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/Amaury/arkiv-format/go/arkiv"
+)
+
+// Aliases for the CLI commands for convenience.
+var (
+	aliasesCreate  = map[string]bool{"c": true, "-c": true, "create": true, "--create": true}
+	aliasesList    = map[string]bool{"l": true, "-l": true, "ls": true, "--ls": true}
+	aliasesExtract = map[string]bool{"x": true, "-x": true, "extract": true, "--extract": true}
+	aliasesCat     = map[string]bool{"cat": true, "--cat": true}
+	aliasesDiff    = map[string]bool{"diff": true, "--diff": true}
+	aliasesCheck   = map[string]bool{"check": true, "--check": true}
+	aliasesFilter  = map[string]bool{"filter": true, "--filter": true}
+	aliasesRekey   = map[string]bool{"rekey": true, "--rekey": true}
+	aliasesVerify  = map[string]bool{"verify": true, "--verify": true}
+	aliasesInfo    = map[string]bool{"info": true, "--info": true}
+	aliasesReindex = map[string]bool{"reindex": true, "--reindex": true}
+	aliasesKeygen  = map[string]bool{"keygen": true, "--keygen": true}
+	aliasesHelp    = map[string]bool{"h": true, "-h": true, "help": true, "--help": true}
+)
+
+// runCLI parses os.Args and dispatches to create, list, extract, cat,
+// diff, check, filter, rekey, verify, info, reindex or keygen commands. The
+// password is read as selected by the password options, from the environment
+// variable ARKIV_PASS, or asked on the terminal (reindex and keygen do not
+// need it, nor do archives encrypted for recipients, read with --identity).
+func runCLI(argv []string) error {
+	if len(argv) < 2 || aliasesHelp[argv[1]] {
+		printHelp()
+		return nil
+	}
+
+	cmd := argv[1]
+	switch {
+	case aliasesCreate[cmd]:
+		usage := "usage: arkiv-format create [--jobs N] [--stats] [--base PREV.arkiv] [--format VERSION | --aead] [KDF OPTIONS] [--recipient PUBKEY]... ARCHIVE.arkiv PATH [PATH ...]"
+		flags := newFlagSet(cmd)
+		stats := flags.Bool("stats", false, "print deduplication statistics")
+		jobs := flags.Int("jobs", 1, "number of parallel workers (0 for all CPUs)")
+		base := flags.String("base", "", "base archive of an incremental archive")
+		format := flags.String("format", "", "format `VERSION` to write (default "+arkiv.DefaultFormat+")")
+		aead := flags.Bool("aead", false, "use authenticated encryption (format "+arkiv.MagicAEAD+")")
+		kdf := addKDFFlags(flags)
+		var recipients []*arkiv.Recipient
+		flags.Func("recipient", "encrypt for the public key `PUBKEY` instead of a password (repeatable)", func(s string) error {
+			r, err := arkiv.ParseRecipient(s)
+			recipients = append(recipients, r)
+			return err
+		})
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return errors.New(usage)
+		}
+		archive := args[0]
+		inputs := args[1:]
+		var pass []byte
+		if len(recipients) == 0 {
+			if pass, err = pw.password(true); err != nil {
+				return err
+			}
+		}
+		kdfOpts, err := kdf.options()
+		if err != nil {
+			return err
+		}
+		opts := arkiv.WriterOptions{Jobs: jobCount(*jobs), Base: *base, Format: *format, KDF: kdfOpts, Recipients: recipients}
+		if *aead {
+			if *format != "" && *format != arkiv.MagicAEAD {
+				return fmt.Errorf("--aead conflicts with --format %s", *format)
+			}
+			opts.Format = arkiv.MagicAEAD
+		}
+		w := arkiv.NewArchiveWriterWithOptions(archive, pass, opts)
+		defer w.Close()
+		if err := w.Create(inputs); err != nil {
+			return err
+		}
+		if *stats {
+			printStats(w.Stats())
+		}
+		return nil
+
+	case aliasesList[cmd]:
+		usage := "usage: arkiv-format ls [PASSWORD OPTIONS | --identity KEYFILE] ARCHIVE.arkiv [PREFIX ...]"
+		flags := newFlagSet(cmd)
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) < 1 {
+			return errors.New(usage)
+		}
+		archive := args[0]
+		prefixes := args[1:]
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(archive, pass, arkiv.ReaderOptions{Identities: ids})
+		defer r.Close()
+		return r.List(prefixes)
+
+	case aliasesExtract[cmd]:
+		usage := "usage: arkiv-format extract [--jobs N] [--quarantine] ARCHIVE.arkiv [DEST] [PREFIX ...]"
+		flags := newFlagSet(cmd)
+		jobs := flags.Int("jobs", 1, "number of parallel workers (0 for all CPUs)")
+		quarantine := flags.Bool("quarantine", false, "keep going when a content hash does not match")
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		dest := "."
+		var prefixes []string
+		if len(args) < 1 {
+			return errors.New(usage)
+		}
+		archive := args[0]
+		if len(args) >= 2 {
+			dest = args[1]
+			if len(args) > 2 {
+				prefixes = args[2:]
+			}
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(archive, pass, arkiv.ReaderOptions{Jobs: jobCount(*jobs), Quarantine: *quarantine, Identities: ids})
+		defer r.Close()
+		return r.Extract(dest, prefixes)
+
+	case aliasesCat[cmd]:
+		usage := "usage: arkiv-format cat [PASSWORD OPTIONS | --identity KEYFILE] ARCHIVE.arkiv PATH"
+		flags := newFlagSet(cmd)
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(args[0], pass, arkiv.ReaderOptions{Identities: ids})
+		defer r.Close()
+		rc, err := r.OpenFile(args[1])
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = io.Copy(os.Stdout, rc)
+		return err
+
+	case aliasesDiff[cmd]:
+		usage := "usage: arkiv-format diff [--json] OLD.arkiv NEW.arkiv [PREFIX ...]"
+		flags := newFlagSet(cmd)
+		asJSON := flags.Bool("json", false, "print the changes as JSON")
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return errors.New(usage)
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		oldR := arkiv.NewArchiveReaderWithOptions(args[0], pass, arkiv.ReaderOptions{Identities: ids})
+		defer oldR.Close()
+		newR := arkiv.NewArchiveReaderWithOptions(args[1], append([]byte(nil), pass...), arkiv.ReaderOptions{Identities: ids})
+		defer newR.Close()
+		changes, err := newR.Diff(oldR, args[2:])
+		if err != nil {
+			return err
+		}
+		return printChanges(changes, *asJSON)
+
+	case aliasesCheck[cmd]:
+		usage := "usage: arkiv-format check [--json] ARCHIVE.arkiv ROOT [PREFIX ...]"
+		flags := newFlagSet(cmd)
+		asJSON := flags.Bool("json", false, "print the differences as JSON")
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return errors.New(usage)
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(args[0], pass, arkiv.ReaderOptions{Identities: ids})
+		defer r.Close()
+		changes, err := r.Check(args[1], args[2:])
+		if err != nil {
+			return err
+		}
+		if err := printChanges(changes, *asJSON); err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			return fmt.Errorf("%d difference(s) found", len(changes))
+		}
+		return nil
+
+	case aliasesFilter[cmd]:
+		usage := "usage: arkiv-format filter [--include PATTERN]... [--exclude PATTERN]... IN.arkiv OUT.arkiv"
+		flags := newFlagSet(cmd)
+		var opts arkiv.FilterOptions
+		flags.Func("include", "keep only the paths matching `PATTERN` (repeatable)", func(p string) error {
+			opts.Include = append(opts.Include, p)
+			return nil
+		})
+		flags.Func("exclude", "drop the paths matching `PATTERN` (repeatable)", func(p string) error {
+			opts.Exclude = append(opts.Exclude, p)
+			return nil
+		})
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(args[0], pass, arkiv.ReaderOptions{Identities: ids})
+		defer r.Close()
+		n, err := r.Filter(args[1], opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d entries kept\n", n)
+		return nil
+
+	case aliasesRekey[cmd]:
+		usage := "usage: arkiv-format rekey [PASSWORD OPTIONS] IN.arkiv OUT.arkiv"
+		flags := newFlagSet(cmd)
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Current password: ")
+		newPw := addPasswordFlags(flags, "new-", arkiv.EnvNewPass, "New password: ")
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		pass, err := pw.password(false)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReader(args[0], pass)
+		defer r.Close()
+		newPass, err := newPw.password(true)
+		if err != nil {
+			return err
+		}
+		return r.Rekey(args[1], newPass)
+
+	case aliasesVerify[cmd]:
+		usage := "usage: arkiv-format verify [--json] ARCHIVE.arkiv"
+		flags := newFlagSet(cmd)
+		asJSON := flags.Bool("json", false, "print the report as JSON")
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(args[0], pass, arkiv.ReaderOptions{Identities: ids})
+		defer r.Close()
+		rep, err := r.Verify()
+		if err != nil {
+			return err
+		}
+		if err := printVerifyReport(rep, *asJSON); err != nil {
+			return err
+		}
+		if !rep.OK() {
+			return fmt.Errorf("%d integrity problem(s) found", len(rep.Problems))
+		}
+		return nil
+
+	case aliasesInfo[cmd]:
+		usage := "usage: arkiv-format info [PASSWORD OPTIONS | --identity KEYFILE] ARCHIVE.arkiv"
+		flags := newFlagSet(cmd)
+		pw := addPasswordFlags(flags, "", arkiv.EnvPass, "Password: ")
+		id := addIdentityFlags(flags)
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		pass, ids, err := id.credentials(pw)
+		if err != nil {
+			return err
+		}
+		r := arkiv.NewArchiveReaderWithOptions(args[0], pass, arkiv.ReaderOptions{Identities: ids})
+		defer r.Close()
+		return printInfo(r)
+
+	case aliasesReindex[cmd]:
+		if len(argv) != 3 {
+			return errors.New("usage: arkiv-format reindex ARCHIVE.arkiv")
+		}
+		// The sidecar only holds member names and offsets: no password.
+		r := arkiv.NewArchiveReader(argv[2], nil)
+		defer r.Close()
+		return r.Reindex()
+
+	case aliasesKeygen[cmd]:
+		usage := "usage: arkiv-format keygen [-o KEYFILE]"
+		flags := newFlagSet(cmd)
+		out := flags.String("o", "", "write the identity to `KEYFILE` instead of stdout")
+		args, err := parseFlags(flags, argv[2:], usage)
+		if err != nil {
+			return err
+		}
+		if len(args) != 0 {
+			return errors.New(usage)
+		}
+		return generateIdentity(*out)
+
+	default:
+		return fmt.Errorf("unknown command %q. Use --help", cmd)
+	}
+}
+
+// newFlagSet returns an empty flag set for a command. Errors are returned
+// to the caller instead of being printed.
+func newFlagSet(cmd string) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+// parseFlags parses the options of a command, placed before or after its
+// positional arguments, and returns those arguments.
+func parseFlags(flags *flag.FlagSet, args []string, usage string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, fmt.Errorf("%v\n%s", err, usage)
+		}
+		rest := flags.Args()
+		// Options may follow the arguments, until a "--".
+		if n := len(args) - len(rest); len(rest) == 0 || (n > 0 && args[n-1] == "--") {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// passwordFlags holds the options telling where a command reads a
+// password from.
+type passwordFlags struct {
+	prefix  string
+	env     string
+	prompt  string
+	file    string
+	fd      int
+	command string
+}
+
+// addPasswordFlags registers the --PREFIXpass-file, --PREFIXpass-fd and
+// --PREFIXpass-command options of a command. Without them, the password is
+// read from the environment variable env or, when it is not set, asked on
+// the terminal with prompt.
+func addPasswordFlags(flags *flag.FlagSet, prefix, env, prompt string) *passwordFlags {
+	p := &passwordFlags{prefix: prefix, env: env, prompt: prompt}
+	flags.StringVar(&p.file, prefix+"pass-file", "", "read the password from the first line of `FILE`")
+	flags.IntVar(&p.fd, prefix+"pass-fd", -1, "read the password from the file descriptor `N`")
+	flags.StringVar(&p.command, prefix+"pass-command", "", "read the password from the output of `COMMAND`")
+	return p
+}
+
+// provider returns the password provider selected by the options.
+func (p *passwordFlags) provider() (arkiv.PasswordProvider, error) {
+	var providers []arkiv.PasswordProvider
+	if p.file != "" {
+		providers = append(providers, arkiv.FilePassword(p.file))
+	}
+	if p.fd >= 0 {
+		providers = append(providers, arkiv.FDPassword(uintptr(p.fd)))
+	}
+	if p.command != "" {
+		providers = append(providers, arkiv.CommandPassword(p.command))
+	}
+	switch {
+	case len(providers) > 1:
+		return nil, fmt.Errorf("only one of --%[1]spass-file, --%[1]spass-fd and --%[1]spass-command may be given", p.prefix)
+	case len(providers) == 1:
+		return providers[0], nil
+	case os.Getenv(p.env) != "":
+		return arkiv.EnvPassword(p.env), nil
+	}
+	return arkiv.PromptPassword(p.prompt), nil
+}
+
+// password reads the password; confirm is set for a new password.
+func (p *passwordFlags) password(confirm bool) ([]byte, error) {
+	provider, err := p.provider()
+	if err != nil {
+		return nil, err
+	}
+	pass, err := provider.Password(confirm)
+	if errors.Is(err, arkiv.ErrNoPassword) {
+		return nil, fmt.Errorf("%w (set %s or use --%[3]spass-file, --%[3]spass-fd or --%[3]spass-command)", err, p.env, p.prefix)
+	}
+	return pass, err
+}
+
+// identityFlags holds the --identity options of a command reading an
+// archive.
+type identityFlags struct {
+	files []string
+}
+
+// addIdentityFlags registers the repeatable --identity option of a command.
+func addIdentityFlags(flags *flag.FlagSet) *identityFlags {
+	i := &identityFlags{}
+	flags.Func("identity", "decrypt with the identities of `KEYFILE` instead of a password (repeatable)", func(f string) error {
+		i.files = append(i.files, f)
+		return nil
+	})
+	return i
+}
+
+// credentials reads the identities of the --identity files or, without
+// them, the password selected by pw.
+func (i *identityFlags) credentials(pw *passwordFlags) ([]byte, []*arkiv.Identity, error) {
+	if len(i.files) == 0 {
+		pass, err := pw.password(false)
+		return pass, nil, err
+	}
+	var ids []*arkiv.Identity
+	for _, f := range i.files {
+		list, err := arkiv.ReadIdentityFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, list...)
+	}
+	return nil, ids, nil
+}
+
+// generateIdentity writes a new identity to the file out, which must not
+// exist, and its public key on stderr; or both on stdout when out is empty.
+func generateIdentity(out string) error {
+	id, err := arkiv.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), id.Recipient(), id)
+	if out == "" {
+		_, err = io.WriteString(os.Stdout, content)
+		return err
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Public key: %s\n", id.Recipient())
+	return nil
+}
+
+// kdfFlags holds the options selecting the key derivation function of a
+// new archive.
+type kdfFlags struct {
+	name    string
+	time    uint
+	memory  uint
+	threads uint
+}
+
+// addKDFFlags registers the --kdf, --kdf-time, --kdf-memory and
+// --kdf-threads options of a command.
+func addKDFFlags(flags *flag.FlagSet) *kdfFlags {
+	k := &kdfFlags{}
+	flags.StringVar(&k.name, "kdf", "", "key derivation function `NAME` (argon2id, scrypt or pbkdf2-sha256)")
+	flags.UintVar(&k.time, "kdf-time", 0, "passes of Argon2id or iterations of PBKDF2")
+	flags.UintVar(&k.memory, "kdf-memory", 0, "memory of Argon2id or scrypt, in `KiB`")
+	flags.UintVar(&k.threads, "kdf-threads", 0, "parallelism of Argon2id or scrypt")
+	return k
+}
+
+// options converts the flags to KDF options.
+func (k *kdfFlags) options() (arkiv.KDFOptions, error) {
+	if k.time > math.MaxUint32 || k.memory > math.MaxUint32 || k.threads > math.MaxUint8 {
+		return arkiv.KDFOptions{}, errors.New("key derivation parameter out of range")
+	}
+	return arkiv.KDFOptions{Name: k.name, Time: uint32(k.time), Memory: uint32(k.memory), Threads: uint8(k.threads)}, nil
+}
+
+// jobCount converts a --jobs value to a number of workers: 0 (or less)
+// means one per CPU.
+func jobCount(n int) int {
+	if n < 1 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// printStats prints the content statistics of a created archive on stderr.
+func printStats(st arkiv.Stats) {
+	saved := 0.0
+	if st.Bytes > 0 {
+		saved = float64(st.DedupBytes) * 100 / float64(st.Bytes)
+	}
+	fmt.Fprintf(os.Stderr, "files: %d (%d bytes)\n", st.Files, st.Bytes)
+	fmt.Fprintf(os.Stderr, "stored: %d (%d bytes)\n", st.StoredFiles, st.StoredBytes)
+	fmt.Fprintf(os.Stderr, "deduplicated: %d (%d bytes, %.1f%%)\n", st.DedupFiles, st.DedupBytes, saved)
+}
+
+// printChanges prints the changes found by diff or check on stdout, as
+// JSON or one per line.
+func printChanges(changes []arkiv.Change, asJSON bool) error {
+	if asJSON {
+		if changes == nil {
+			changes = []arkiv.Change{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+// printVerifyReport prints a verification report on stdout, as JSON or as
+// one line per problem followed by a summary.
+func printVerifyReport(rep *arkiv.VerifyReport, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	for _, p := range rep.Problems {
+		fmt.Println(p)
+	}
+	if rep.Base != "" {
+		fmt.Printf("incremental, based on %s\n", rep.Base)
+	}
+	fmt.Printf("%d members, %d entries, %d meta, %d data, %d problem(s)\n",
+		rep.Members, rep.Entries, rep.MetaMembers, rep.DataMembers, len(rep.Problems))
+	return nil
+}
+
+// printInfo prints the format version of an archive and a summary of its
+// content on stdout.
+func printInfo(r *arkiv.ArchiveReader) error {
+	format, err := r.Format()
+	if err != nil {
+		return err
+	}
+	idx, err := r.Index()
+	if err != nil {
+		return err
+	}
+	base, err := r.BasePath()
+	if err != nil {
+		return err
+	}
+	kdf, err := r.KeyDerivation()
+	if err != nil {
+		return err
+	}
+	shell := "no"
+	if format.ShellCompatible {
+		shell = "yes"
+	}
+	fmt.Printf("format:      %s\n", format.Magic)
+	fmt.Printf("encryption:  %s\n", format.Cipher)
+	if kdf != "" {
+		fmt.Printf("key:         %s\n", kdf)
+	}
+	fmt.Printf("hash:        %s\n", format.Hash)
+	fmt.Printf("shell tools: %s\n", shell)
+	fmt.Printf("entries:     %d\n", len(idx.Entries))
+	if base != "" {
+		fmt.Printf("base:        %s\n", base)
+	}
+	return nil
+}
+
+// printHelp prints CLI usage, environment, and examples.
+func printHelp() {
+	fmt.Println(`Arkiv — single binary compatible with the Arkiv format
+
+USAGE:
+  arkiv-format (c|-c|create|--create)   [OPTIONS] ARCHIVE.arkiv  PATH [PATH ...]
+  arkiv-format (l|-l|ls|--ls)           [OPTIONS] ARCHIVE.arkiv  [PREFIX ...]
+  arkiv-format (x|-x|extract|--extract) [OPTIONS] ARCHIVE.arkiv  DEST [PREFIX ...]
+  arkiv-format (cat|--cat)              [OPTIONS] ARCHIVE.arkiv  PATH
+  arkiv-format (diff|--diff)            [OPTIONS] OLD.arkiv  NEW.arkiv [PREFIX ...]
+  arkiv-format (check|--check)          [OPTIONS] ARCHIVE.arkiv  ROOT [PREFIX ...]
+  arkiv-format (filter|--filter)        [OPTIONS] IN.arkiv  OUT.arkiv
+  arkiv-format (rekey|--rekey)          [OPTIONS] IN.arkiv  OUT.arkiv
+  arkiv-format (verify|--verify)        [OPTIONS] ARCHIVE.arkiv
+  arkiv-format (info|--info)            [OPTIONS] ARCHIVE.arkiv
+  arkiv-format (reindex|--reindex)      ARCHIVE.arkiv
+  arkiv-format (keygen|--keygen)        [-o KEYFILE]
+  arkiv-format (h|-h|help|--help)
+
+PASSWORD OPTIONS (all commands but reindex and keygen):
+  --pass-file FILE       Read the password from the first line of FILE
+  --pass-fd N            Read the password from the file descriptor N
+  --pass-command CMD     Read the password from the output of CMD (run by /bin/sh)
+  Without them, ARKIV_PASS is used if set, else the password is asked on the
+  terminal (twice for create). rekey reads the new password the same way with
+  --new-pass-file, --new-pass-fd, --new-pass-command and ARKIV_NEW_PASS.
+
+CREATE OPTIONS:
+  --jobs N    Hash, compress and encrypt with N workers (0: one per CPU)
+  --stats     Print deduplication statistics on stderr
+  --base PREV Incremental archive: record PREV as base and omit the
+              contents already stored in PREV or its own bases
+  --format V  Format version to write: arkiv003 (default, authenticated
+              encryption, master key derived with Argon2id, see KDF
+              OPTIONS), arkiv002 (authenticated encryption, PBKDF2 for
+              every member) or arkiv001 (AES-256-CBC, PBKDF2 for every
+              member, but the only one the shell tools can read)
+  --aead      Same as --format arkiv002
+  --recipient PUBKEY
+              Encrypt for the X25519 public key PUBKEY (age1..., repeatable)
+              instead of a password: no password is read, and only the
+              matching identities can read the archive (not with --base)
+
+IDENTITY OPTIONS (ls, extract, cat, diff, check, filter, verify, info):
+  --identity KEYFILE
+              Read an archive encrypted for recipients with the identities
+              (AGE-SECRET-KEY-1..., one per line) of KEYFILE, repeatable,
+              instead of a password
+
+KEYGEN OPTIONS:
+  -o KEYFILE  Write the new identity to KEYFILE (mode 0600, must not exist)
+              and its public key on stderr, instead of both on stdout.
+              Keys of age-keygen are accepted too
+
+KDF OPTIONS (create, format arkiv003 only):
+  --kdf NAME         Derivation of the master key: argon2id (default), scrypt
+                     or pbkdf2-sha256
+  --kdf-time N       Passes of Argon2id (default 3, at most 64), iterations
+                     of PBKDF2 (default 600000, at most 100000000)
+  --kdf-memory KIB   Memory of Argon2id or scrypt in KiB (default 65536, at
+                     most 4194304)
+  --kdf-threads N    Parallelism of Argon2id (default 4) or scrypt (default 1)
+
+DIFF, CHECK AND VERIFY OPTIONS:
+  --json      Print the result as JSON
+
+EXTRACT OPTIONS:
+  --jobs N      Decrypt, decompress and write with N workers (0: one per CPU)
+  --quarantine  Rename files whose content hash does not match the index
+                (suffix .arkiv-corrupt) and go on; exit status is still 1
+
+FILTER OPTIONS:
+  --include PATTERN  Keep only the paths matching PATTERN (repeatable)
+  --exclude PATTERN  Drop the paths matching PATTERN (repeatable)
+                     Patterns use shell-style wildcards and also match
+                     every path under a matching directory
+
+ENV:
+  ARKIV_PASS      Password of the archive. Its key derivation depends on the
+                  format: PBKDF2-SHA256 (10000 iterations) for every member
+                  in arkiv001 and arkiv002, the KDF recorded in kdf.zst
+                  (Argon2id by default) in arkiv003; see the info command
+  ARKIV_NEW_PASS  New password of the rekey command
+
+EXIT STATUS:
+  0  Success
+  1  Error (including differences found by check and problems found by verify)
+  3  Wrong password, or no identity matching a recipient of the archive
+
+DEPENDENCIES:
+  - github.com/klauspost/compress/zstd
+  - golang.org/x/crypto (pbkdf2, argon2, scrypt, hkdf, curve25519, chacha20poly1305)
+  - golang.org/x/term
+
+EXAMPLES:
+  export ARKIV_PASS=secret
+  arkiv-format create backup.arkiv /etc /var/log/syslog
+  arkiv-format ls     backup.arkiv
+  arkiv-format ls     backup.arkiv /etc/ssh
+  arkiv-format create --base backup.arkiv monday.arkiv /etc
+  arkiv-format extract backup.arkiv /restore /etc/ssh
+  arkiv-format cat     backup.arkiv /etc/hosts
+  arkiv-format diff    monday.arkiv tuesday.arkiv /etc
+  arkiv-format check   backup.arkiv /restore
+  arkiv-format filter --exclude '/home/*/.ssh' backup.arkiv clean.arkiv
+  ARKIV_NEW_PASS=newsecret arkiv-format rekey backup.arkiv backup-new.arkiv
+  arkiv-format verify  backup.arkiv
+  arkiv-format info    backup.arkiv
+  arkiv-format reindex backup.arkiv    # writes backup.arkiv.idx
+  arkiv-format ls --pass-command 'pass show backup' backup.arkiv
+  arkiv-format ls --pass-fd 3 backup.arkiv 3< ~/.arkiv-pass
+  arkiv-format keygen -o ~/.arkiv-key      # prints the public key age1...
+  arkiv-format create --recipient age1... backup.arkiv /etc
+  arkiv-format extract --identity ~/.arkiv-key backup.arkiv /restore`)
+}
+
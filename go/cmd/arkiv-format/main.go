@@ -1,18 +1,28 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
-	arkivformat "github.com/Amaury/arkiv-format/go/internal/arkiv-format"
+	"github.com/Amaury/arkiv-format/go/arkiv"
+)
+
+// Exit codes of the command.
+const (
+	exitError         = 1 // any error
+	exitWrongPassword = 3 // the password or the identities do not open the archive
 )
 
 // main is the entrypoint. It delegates argument parsing and command handling
-// to the arkivformat package.
+// to runCLI, which drives the arkiv package.
 func main() {
-	if err := arkivformat.RunCLI(os.Args); err != nil {
+	if err := runCLI(os.Args); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
+		if errors.Is(err, arkiv.ErrWrongPassword) || errors.Is(err, arkiv.ErrNoIdentity) {
+			os.Exit(exitWrongPassword)
+		}
+		os.Exit(exitError)
 	}
 }
 
@@ -5,4 +5,7 @@ go 1.22
 require (
 	github.com/klauspost/compress v1.17.9
 	golang.org/x/crypto v0.25.0
+	golang.org/x/term v0.22.0
 )
+
+require golang.org/x/sys v0.22.0 // indirect
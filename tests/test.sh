@@ -19,6 +19,24 @@ success() {
 	echo "$(tput setab 2)$*$(tput sgr0)"
 }
 
+# Write a copy of an archive whose first member matching a pattern has its
+# last byte changed.
+# @param	Archive.
+# @param	Member name pattern (grep).
+# @param	Output archive.
+corrupt() {
+	rm -rf ./corrupt.tmp
+	mkdir corrupt.tmp
+	tar -xf "$1" -C corrupt.tmp
+	CORRUPT_FILE="corrupt.tmp/$(tar -tf "$1" | grep -m 1 -- "$2")"
+	CORRUPT_POS=$(($(wc -c < "$CORRUPT_FILE") - 1))
+	CORRUPT_BYTE=$(od -An -tu1 -j $CORRUPT_POS -N 1 "$CORRUPT_FILE" | tr -d ' ')
+	printf "\\$(printf %o $(((CORRUPT_BYTE + 1) % 256)))" |
+		dd of="$CORRUPT_FILE" bs=1 seek=$CORRUPT_POS conv=notrunc 2> /dev/null
+	tar -cf "$3" -C corrupt.tmp $(tar -tf "$1")
+	rm -rf ./corrupt.tmp
+}
+
 # ########## INIT ##########
 #PATH=$(pwd)/../shell/:$(pwd)/../go/:$PATH
 export ARKIV_PASS="$(head -c 10 /dev/urandom | base64)"
@@ -162,6 +180,559 @@ test4() {
 	success "[$TYPE] TEST 4"
 }
 
+# ########## TEST 5: DEDUPLICATED FILES ##########
+# @param	Program type ('sh' or 'go').
+test5() {
+	TYPE="$1"
+	# archive creation (two paths sharing the same content)
+	mkdir src-05 || fail "[$TYPE] TEST 5: unable to create directory 'src-05'"
+	if ! mkdir res-05; then
+		rm -rf ./src-05
+		fail "[$TYPE] TEST 5: unable to create directory 'res-05'"
+	fi
+	printf 'same' > src-05/x.txt
+	printf 'same' > src-05/y.txt
+	if ! $EXEC_CMD_CREATE a.arkiv src-05; then
+		rm -rf ./a.arkiv ./src-05 ./res-05
+		fail "[$TYPE] TEST 5: arkiv-create"
+	fi
+	# extraction
+	if ! $EXEC_CMD_EXTRACT a.arkiv res-05 ||
+	   [ "$(cat "res-05/src-05/x.txt" 2> /dev/null)" != "same" ] ||
+	   [ "$(cat "res-05/src-05/y.txt" 2> /dev/null)" != "same" ]; then
+		rm -rf ./a.arkiv ./src-05 ./res-05
+		fail "[$TYPE] TEST 5: arkiv-extract"
+	fi
+	rm -rf ./a.arkiv ./src-05 ./res-05
+	success "[$TYPE] TEST 5"
+}
+
+# ########## TEST 6: VERIFY, CAT, REINDEX (Go only) ##########
+test6() {
+	TYPE="go"
+	mkdir res-06 || fail "[$TYPE] TEST 6: unable to create directory 'res-06'"
+	if ! arkiv-format create a.arkiv src-02; then
+		rm -rf ./a.arkiv ./res-06
+		fail "[$TYPE] TEST 6: arkiv-format create"
+	fi
+	# full integrity check
+	if ! arkiv-format verify a.arkiv > /dev/null ||
+	   [ "$(arkiv-format verify --json a.arkiv | grep '"problems": \[\]')" = "" ]; then
+		rm -rf ./a.arkiv ./res-06
+		fail "[$TYPE] TEST 6: arkiv-format verify"
+	fi
+	# one file to stdout; directories are refused
+	if [ "$(arkiv-format cat a.arkiv src-02/sub1/a.txt)" != "$(cat src-02/sub1/a.txt)" ] ||
+	   arkiv-format cat a.arkiv src-02/sub1 > /dev/null 2>&1; then
+		rm -rf ./a.arkiv ./res-06
+		fail "[$TYPE] TEST 6: arkiv-format cat"
+	fi
+	# member index sidecar, then parallel extraction through it
+	if ! arkiv-format reindex a.arkiv ||
+	   [ ! -f a.arkiv.idx ] ||
+	   ! arkiv-format extract --jobs 4 a.arkiv res-06 ||
+	   ! diff -r src-02 res-06/src-02 > /dev/null; then
+		rm -rf ./a.arkiv ./a.arkiv.idx ./res-06
+		fail "[$TYPE] TEST 6: arkiv-format reindex / extract --jobs"
+	fi
+	rm -rf ./a.arkiv ./a.arkiv.idx ./res-06
+	success "[$TYPE] TEST 6"
+}
+
+# ########## TEST 7: INCREMENTAL ARCHIVES (Go only) ##########
+test7() {
+	TYPE="go"
+	mkdir res-07 || fail "[$TYPE] TEST 7: unable to create directory 'res-07'"
+	cp -a src-02 src-07
+	if ! arkiv-format create a.arkiv src-07; then
+		rm -rf ./a.arkiv ./src-07 ./res-07
+		fail "[$TYPE] TEST 7: arkiv-format create"
+	fi
+	# only the new content is stored in the incremental archive
+	echo "new file" > src-07/sub1/new.txt
+	if ! arkiv-format create --base a.arkiv b.arkiv src-07 ||
+	   [ "$(arkiv-format verify --json b.arkiv | grep '"data_members": 1,')" = "" ] ||
+	   ! arkiv-format verify b.arkiv > /dev/null; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-07 ./res-07
+		fail "[$TYPE] TEST 7: arkiv-format create --base"
+	fi
+	# the whole tree is restored through the base
+	if ! arkiv-format extract b.arkiv res-07 ||
+	   ! diff -r src-07 res-07/src-07 > /dev/null; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-07 ./res-07
+		fail "[$TYPE] TEST 7: arkiv-format extract (incremental)"
+	fi
+	# a missing base is detected
+	mv a.arkiv c.arkiv
+	if arkiv-format verify b.arkiv > /dev/null 2>&1; then
+		rm -rf ./b.arkiv ./c.arkiv ./src-07 ./res-07
+		fail "[$TYPE] TEST 7: arkiv-format verify (missing base)"
+	fi
+	rm -rf ./b.arkiv ./c.arkiv ./src-07 ./res-07
+	success "[$TYPE] TEST 7"
+}
+
+# ########## TEST 8: FILTER (Go only) ##########
+test8() {
+	TYPE="go"
+	mkdir res-08 || fail "[$TYPE] TEST 8: unable to create directory 'res-08'"
+	if ! arkiv-format create a.arkiv src-02; then
+		rm -rf ./a.arkiv ./res-08
+		fail "[$TYPE] TEST 8: arkiv-format create"
+	fi
+	# drop a subtree
+	if ! arkiv-format filter a.arkiv b.arkiv --exclude src-02/sub2 2> /dev/null ||
+	   ! arkiv-format verify b.arkiv > /dev/null ||
+	   [ "$(arkiv-format ls b.arkiv | grep "sub2")" != "" ] ||
+	   [ "$(arkiv-format ls b.arkiv | grep "a.txt")" = "" ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-08
+		fail "[$TYPE] TEST 8: arkiv-format filter --exclude"
+	fi
+	# keep only one file, then extract it
+	if ! arkiv-format filter --include 'src-02/*/*/z.txt' a.arkiv c.arkiv 2> /dev/null ||
+	   ! arkiv-format extract c.arkiv res-08 ||
+	   ! diff src-02/sub2/sub3/z.txt res-08/src-02/sub2/sub3/z.txt > /dev/null ||
+	   [ -e res-08/src-02/sub1 ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./c.arkiv ./res-08
+		fail "[$TYPE] TEST 8: arkiv-format filter --include"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./c.arkiv ./res-08
+	success "[$TYPE] TEST 8"
+}
+
+# ########## TEST 9: REKEY (Go only) ##########
+test9() {
+	TYPE="go"
+	mkdir res-09 || fail "[$TYPE] TEST 9: unable to create directory 'res-09'"
+	if ! arkiv-format create a.arkiv src-02; then
+		rm -rf ./a.arkiv ./res-09
+		fail "[$TYPE] TEST 9: arkiv-format create"
+	fi
+	NEW_PASS="$(head -c 10 /dev/urandom | base64)"
+	# the copy only opens with the new password
+	if ! ARKIV_NEW_PASS="$NEW_PASS" arkiv-format rekey a.arkiv b.arkiv ||
+	   ! ARKIV_PASS="$NEW_PASS" arkiv-format verify b.arkiv > /dev/null ||
+	   arkiv-format ls b.arkiv > /dev/null 2>&1; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-09
+		fail "[$TYPE] TEST 9: arkiv-format rekey"
+	fi
+	if ! ARKIV_PASS="$NEW_PASS" arkiv-format extract b.arkiv res-09 ||
+	   ! diff -r src-02 res-09/src-02 > /dev/null; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-09
+		fail "[$TYPE] TEST 9: arkiv-format extract (rekeyed)"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./res-09
+	success "[$TYPE] TEST 9"
+}
+
+# ########## TEST 10: PASSWORD SOURCES (Go only) ##########
+test10() {
+	TYPE="go"
+	if ! arkiv-format create a.arkiv src-02; then
+		rm -f ./a.arkiv
+		fail "[$TYPE] TEST 10: arkiv-format create"
+	fi
+	printf '%s\n' "$ARKIV_PASS" > pass.txt
+	# file, file descriptor and command, without ARKIV_PASS
+	if [ "$(env -u ARKIV_PASS arkiv-format ls --pass-file pass.txt a.arkiv | grep "a.txt")" = "" ] ||
+	   [ "$(env -u ARKIV_PASS arkiv-format ls a.arkiv --pass-fd 3 3< pass.txt | grep "a.txt")" = "" ] ||
+	   [ "$(env -u ARKIV_PASS arkiv-format ls --pass-command 'cat pass.txt' a.arkiv | grep "a.txt")" = "" ]; then
+		rm -f ./a.arkiv ./pass.txt
+		fail "[$TYPE] TEST 10: arkiv-format --pass-file / --pass-fd / --pass-command"
+	fi
+	# a wrong password has its own exit status
+	ARKIV_PASS="wrong-$ARKIV_PASS" arkiv-format ls a.arkiv > /dev/null 2>&1
+	if [ $? -ne 3 ]; then
+		rm -f ./a.arkiv ./pass.txt
+		fail "[$TYPE] TEST 10: arkiv-format with a wrong password"
+	fi
+	rm -f ./a.arkiv ./pass.txt
+	success "[$TYPE] TEST 10"
+}
+
+# ########## TEST 11: FAILED CREATE (Go only) ##########
+test11() {
+	TYPE="go"
+	# an unsupported file (character device) fails the creation
+	if arkiv-format create a.arkiv src-02 /dev/null 2> /dev/null; then
+		rm -f ./a.arkiv
+		fail "[$TYPE] TEST 11: arkiv-format create (unsupported file)"
+	fi
+	# and leaves no archive behind
+	if [ -e a.arkiv ] ||
+	   arkiv-format ls a.arkiv > /dev/null 2>&1 ||
+	   arkiv-format verify a.arkiv > /dev/null 2>&1; then
+		rm -f ./a.arkiv
+		fail "[$TYPE] TEST 11: arkiv-format create left an archive"
+	fi
+	success "[$TYPE] TEST 11"
+}
+
+# ########## TEST 12: PARALLEL CREATE (Go only) ##########
+test12() {
+	TYPE="go"
+	mkdir res-12 || fail "[$TYPE] TEST 12: unable to create directory 'res-12'"
+	cp -a src-02 src-12
+	printf 'same' > src-12/x.txt
+	printf 'same' > src-12/sub1/y.txt
+	head -c 300000 /dev/urandom > src-12/sub2/big.bin
+	# one worker and several workers give the same archive content
+	if ! arkiv-format create --jobs 1 a.arkiv src-12 ||
+	   ! arkiv-format create --jobs 4 b.arkiv src-12 ||
+	   [ "$(arkiv-format ls a.arkiv)" != "$(arkiv-format ls b.arkiv)" ] ||
+	   ! arkiv-format verify b.arkiv > /dev/null; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-12 ./res-12
+		fail "[$TYPE] TEST 12: arkiv-format create --jobs"
+	fi
+	if ! arkiv-format extract a.arkiv res-12/1 ||
+	   ! arkiv-format extract b.arkiv res-12/4 ||
+	   ! diff -r res-12/1 res-12/4 > /dev/null ||
+	   ! diff -r src-12 res-12/4/src-12 > /dev/null; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-12 ./res-12
+		fail "[$TYPE] TEST 12: arkiv-format extract (created with --jobs)"
+	fi
+	# a failure leaves no archive behind
+	if arkiv-format create --jobs 4 c.arkiv src-12 /dev/null 2> /dev/null ||
+	   [ -e c.arkiv ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./c.arkiv ./src-12 ./res-12
+		fail "[$TYPE] TEST 12: arkiv-format create --jobs (failure)"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./src-12 ./res-12
+	success "[$TYPE] TEST 12"
+}
+
+# ########## TEST 13: FORMAT ARKIV002 ##########
+test13() {
+	TYPE="go"
+	mkdir res-13 || fail "[$TYPE] TEST 13: unable to create directory 'res-13'"
+	if ! arkiv-format create --format arkiv002 a.arkiv src-02 ||
+	   [ "$(arkiv-format ls a.arkiv | awk '{ print $NF }')" != "$(find src-02 | LC_ALL=C sort)" ] ||
+	   ! arkiv-format extract a.arkiv res-13 ||
+	   ! diff -r src-02 res-13/src-02 > /dev/null ||
+	   ! arkiv-format verify a.arkiv > /dev/null; then
+		rm -rf ./a.arkiv ./res-13
+		fail "[$TYPE] TEST 13: arkiv-format round trip (arkiv002)"
+	fi
+	# a wrong password exits with status 3
+	ARKIV_PASS=wrong arkiv-format ls a.arkiv > /dev/null 2>&1
+	if [ $? -ne 3 ]; then
+		rm -rf ./a.arkiv ./res-13
+		fail "[$TYPE] TEST 13: arkiv-format ls (wrong password, arkiv002)"
+	fi
+	# a tampered chunk is detected
+	corrupt a.arkiv '^data/' b.arkiv
+	if arkiv-format extract b.arkiv res-13/b 2> /dev/null ||
+	   arkiv-format verify b.arkiv > /dev/null 2>&1; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-13
+		fail "[$TYPE] TEST 13: arkiv-format extract (tampered chunk, arkiv002)"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./res-13
+	success "[$TYPE] TEST 13"
+}
+
+# ########## TEST 14: FORMAT VERSIONS ##########
+test14() {
+	TYPE="go"
+	for FORMAT in arkiv001 arkiv002 arkiv003; do
+		if ! arkiv-format create --format $FORMAT a.arkiv src-01 ||
+		   [ "$(arkiv-format info a.arkiv | grep '^format:' | awk '{ print $2 }')" != "$FORMAT" ]; then
+			rm -f ./a.arkiv
+			fail "[$TYPE] TEST 14: arkiv-format info ($FORMAT)"
+		fi
+		rm -f ./a.arkiv
+	done
+	# an archive written by the shell tools
+	if ! ../shell/arkiv-create a.arkiv src-01 > /dev/null ||
+	   [ "$(arkiv-format info a.arkiv | grep '^format:' | awk '{ print $2 }')" != "arkiv001" ]; then
+		rm -f ./a.arkiv
+		fail "[$TYPE] TEST 14: arkiv-format info (shell tools)"
+	fi
+	rm -f ./a.arkiv
+	# the default format
+	if ! arkiv-format create a.arkiv src-01 ||
+	   [ "$(arkiv-format info a.arkiv | grep '^format:' | awk '{ print $2 }')" != "arkiv003" ]; then
+		rm -f ./a.arkiv
+		fail "[$TYPE] TEST 14: arkiv-format info (default format)"
+	fi
+	rm -f ./a.arkiv
+	# an unknown format is rejected
+	if arkiv-format create --format arkiv999 a.arkiv src-01 2> /dev/null ||
+	   [ -e a.arkiv ]; then
+		rm -f ./a.arkiv
+		fail "[$TYPE] TEST 14: arkiv-format create (unknown format)"
+	fi
+	success "[$TYPE] TEST 14"
+}
+
+# ########## TEST 15: FORMAT ARKIV003 AND REKEY ##########
+test15() {
+	TYPE="go"
+	mkdir res-15 || fail "[$TYPE] TEST 15: unable to create directory 'res-15'"
+	if ! arkiv-format create --format arkiv003 a.arkiv src-02 ||
+	   [ "$(arkiv-format ls a.arkiv | awk '{ print $NF }')" != "$(find src-02 | LC_ALL=C sort)" ] ||
+	   ! arkiv-format extract a.arkiv res-15/a ||
+	   ! diff -r src-02 res-15/a/src-02 > /dev/null ||
+	   ! arkiv-format verify a.arkiv > /dev/null; then
+		rm -rf ./a.arkiv ./res-15
+		fail "[$TYPE] TEST 15: arkiv-format round trip (arkiv003)"
+	fi
+	ARKIV_PASS=wrong arkiv-format ls a.arkiv > /dev/null 2>&1
+	if [ $? -ne 3 ]; then
+		rm -rf ./a.arkiv ./res-15
+		fail "[$TYPE] TEST 15: arkiv-format ls (wrong password, arkiv003)"
+	fi
+	# rekey draws a new salt, and only the new password opens the result
+	NEW_PASS="$(head -c 10 /dev/urandom | base64)"
+	if ! ARKIV_NEW_PASS="$NEW_PASS" arkiv-format rekey a.arkiv b.arkiv ||
+	   [ "$(tar -xOf b.arkiv kdf.zst | zstd -dc | grep '^salt=')" = "" ] ||
+	   [ "$(tar -xOf a.arkiv kdf.zst | zstd -dc | grep '^salt=')" = "$(tar -xOf b.arkiv kdf.zst | zstd -dc | grep '^salt=')" ] ||
+	   ! ARKIV_PASS="$NEW_PASS" arkiv-format extract b.arkiv res-15/b ||
+	   ! diff -r src-02 res-15/b/src-02 > /dev/null; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-15
+		fail "[$TYPE] TEST 15: arkiv-format rekey (arkiv003)"
+	fi
+	arkiv-format ls b.arkiv > /dev/null 2>&1
+	if [ $? -ne 3 ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-15
+		fail "[$TYPE] TEST 15: arkiv-format ls (old password after rekey)"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./res-15
+	success "[$TYPE] TEST 15"
+}
+
+# ########## TEST 16: KEY DERIVATION FUNCTIONS ##########
+test16() {
+	TYPE="go"
+	mkdir res-16 || fail "[$TYPE] TEST 16: unable to create directory 'res-16'"
+	for KDF in "argon2id --kdf-time 2 --kdf-memory 16384 --kdf-threads 2:argon2id (time 2, memory 16384 KiB, threads 2)" \
+	           "scrypt --kdf-memory 32768 --kdf-threads 2:scrypt (N 32768, r 8, p 2)" \
+	           "pbkdf2-sha256 --kdf-time 1000:pbkdf2-sha256 (1000 iterations)"; do
+		KDF_OPTIONS="${KDF%%:*}"
+		KDF_INFO="${KDF#*:}"
+		if ! arkiv-format create --kdf $KDF_OPTIONS a.arkiv src-02 ||
+		   [ "$(arkiv-format info a.arkiv | grep '^key:' | sed 's/^key: *//')" != "$KDF_INFO" ] ||
+		   ! arkiv-format extract a.arkiv res-16 ||
+		   ! diff -r src-02 res-16/src-02 > /dev/null; then
+			rm -rf ./a.arkiv ./res-16
+			fail "[$TYPE] TEST 16: arkiv-format round trip (kdf $KDF_OPTIONS)"
+		fi
+		rm -rf ./a.arkiv ./res-16/src-02
+	done
+	# parameters out of bounds are rejected
+	if arkiv-format create --kdf argon2id --kdf-time 1000 a.arkiv src-02 2> /dev/null ||
+	   [ -e a.arkiv ]; then
+		rm -rf ./a.arkiv ./res-16
+		fail "[$TYPE] TEST 16: arkiv-format create (kdf parameters out of bounds)"
+	fi
+	rm -rf ./res-16
+	success "[$TYPE] TEST 16"
+}
+
+# ########## TEST 17: RECIPIENTS ##########
+test17() {
+	TYPE="go"
+	mkdir res-17 || fail "[$TYPE] TEST 17: unable to create directory 'res-17'"
+	if ! arkiv-format keygen -o res-17/key1 2> /dev/null ||
+	   ! arkiv-format keygen -o res-17/key2 2> /dev/null ||
+	   ! arkiv-format keygen -o res-17/key3 2> /dev/null; then
+		rm -rf ./res-17
+		fail "[$TYPE] TEST 17: arkiv-format keygen"
+	fi
+	RECIPIENT1="$(grep '^# public key:' res-17/key1 | awk '{ print $4 }')"
+	RECIPIENT2="$(grep '^# public key:' res-17/key2 | awk '{ print $4 }')"
+	if ! arkiv-format create --recipient "$RECIPIENT1" --recipient "$RECIPIENT2" a.arkiv src-02; then
+		rm -rf ./a.arkiv ./res-17
+		fail "[$TYPE] TEST 17: arkiv-format create --recipient"
+	fi
+	# each identity opens the archive
+	for KEY in key1 key2; do
+		if ! arkiv-format extract --identity res-17/$KEY a.arkiv res-17/$KEY.d ||
+		   ! diff -r src-02 res-17/$KEY.d/src-02 > /dev/null; then
+			rm -rf ./a.arkiv ./res-17
+			fail "[$TYPE] TEST 17: arkiv-format extract --identity ($KEY)"
+		fi
+	done
+	# without identity, or with another one, the exit status is 3
+	arkiv-format extract a.arkiv res-17/none > /dev/null 2>&1
+	if [ $? -ne 3 ]; then
+		rm -rf ./a.arkiv ./res-17
+		fail "[$TYPE] TEST 17: arkiv-format extract (no identity)"
+	fi
+	arkiv-format extract --identity res-17/key3 a.arkiv res-17/key3.d > /dev/null 2>&1
+	if [ $? -ne 3 ]; then
+		rm -rf ./a.arkiv ./res-17
+		fail "[$TYPE] TEST 17: arkiv-format extract --identity (wrong identity)"
+	fi
+	# rekey refuses archives encrypted for recipients
+	if ARKIV_NEW_PASS=new arkiv-format rekey a.arkiv b.arkiv 2> /dev/null ||
+	   [ -e b.arkiv ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./res-17
+		fail "[$TYPE] TEST 17: arkiv-format rekey (recipients)"
+	fi
+	rm -rf ./a.arkiv ./res-17
+	success "[$TYPE] TEST 17"
+}
+
+# ########## TEST 18: CAT ##########
+test18() {
+	TYPE="go"
+	mkdir src-18 || fail "[$TYPE] TEST 18: unable to create directory 'src-18'"
+	printf 'back' > 'src-18/a\b.txt'
+	printf 'quote' > 'src-18/c"d.txt'
+	printf 'plain' > 'src-18/e.txt'
+	if ! arkiv-format create a.arkiv src-18 ||
+	   [ "$(arkiv-format cat a.arkiv 'src-18/e.txt')" != "plain" ]; then
+		rm -rf ./a.arkiv ./src-18
+		fail "[$TYPE] TEST 18: arkiv-format cat"
+	fi
+	# names are accepted unescaped, or escaped as printed by ls
+	if [ "$(arkiv-format cat a.arkiv 'src-18/a\b.txt')" != "back" ] ||
+	   [ "$(arkiv-format cat a.arkiv 'src-18/a\\b.txt')" != "back" ] ||
+	   [ "$(arkiv-format cat a.arkiv 'src-18/c"d.txt')" != "quote" ] ||
+	   [ "$(arkiv-format cat a.arkiv 'src-18/c\"d.txt')" != "quote" ]; then
+		rm -rf ./a.arkiv ./src-18
+		fail "[$TYPE] TEST 18: arkiv-format cat (escaped names)"
+	fi
+	# directories and unknown paths are rejected
+	if arkiv-format cat a.arkiv src-18 > /dev/null 2>&1 ||
+	   arkiv-format cat a.arkiv src-18/none.txt > /dev/null 2>&1; then
+		rm -rf ./a.arkiv ./src-18
+		fail "[$TYPE] TEST 18: arkiv-format cat (not a regular file)"
+	fi
+	rm -rf ./a.arkiv ./src-18
+	success "[$TYPE] TEST 18"
+}
+
+# ########## TEST 19: QUARANTINE ##########
+test19() {
+	TYPE="go"
+	mkdir src-19 res-19 || fail "[$TYPE] TEST 19: unable to create directories 'src-19' and 'res-19'"
+	printf 'aaaaa' > src-19/a.txt
+	printf 'bbbbb' > src-19/b.txt
+	if ! arkiv-format create --jobs 1 a.arkiv src-19; then
+		rm -rf ./a.arkiv ./src-19 ./res-19
+		fail "[$TYPE] TEST 19: arkiv-format create"
+	fi
+	# the data member of a.txt (the first one) is replaced by the one of
+	# b.txt: it still decrypts, but its hash does not match
+	mkdir res-19/tar
+	tar -xf a.arkiv -C res-19/tar
+	cp "res-19/tar/$(tar -tf a.arkiv | grep '^data/' | sed -n 2p)" "res-19/tar/$(tar -tf a.arkiv | grep '^data/' | sed -n 1p)"
+	tar -cf b.arkiv -C res-19/tar $(tar -tf a.arkiv)
+	if arkiv-format extract b.arkiv res-19/x 2> /dev/null ||
+	   [ -e res-19/x/src-19/a.txt ] || [ -e res-19/x/src-19/a.txt.arkiv-corrupt ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-19 ./res-19
+		fail "[$TYPE] TEST 19: arkiv-format extract (corrupted content)"
+	fi
+	if arkiv-format extract --quarantine b.arkiv res-19/q 2> /dev/null ||
+	   [ -e res-19/q/src-19/a.txt ] ||
+	   [ "$(cat res-19/q/src-19/a.txt.arkiv-corrupt 2> /dev/null)" != "bbbbb" ] ||
+	   [ "$(cat res-19/q/src-19/b.txt 2> /dev/null)" != "bbbbb" ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-19 ./res-19
+		fail "[$TYPE] TEST 19: arkiv-format extract --quarantine"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./src-19 ./res-19
+	success "[$TYPE] TEST 19"
+}
+
+# ########## TEST 20: DIFF ##########
+test20() {
+	TYPE="go"
+	mkdir -p src-20/sub || fail "[$TYPE] TEST 20: unable to create directory 'src-20'"
+	printf 'same' > src-20/same.txt
+	printf 'old' > src-20/sub/content.txt
+	printf 'mode' > src-20/sub/mode.txt
+	printf 'gone' > src-20/sub/removed.txt
+	chmod 644 src-20/sub/mode.txt
+	find src-20 -exec touch -t 202001010000 {} +
+	# two archives of the same tree have different prefixes, hence
+	# different hashes, but no difference
+	if ! arkiv-format create a.arkiv src-20 ||
+	   ! arkiv-format create b.arkiv src-20 ||
+	   [ "$(arkiv-format diff a.arkiv b.arkiv)" != "" ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./src-20
+		fail "[$TYPE] TEST 20: arkiv-format diff (same tree)"
+	fi
+	printf 'new' > src-20/sub/content.txt
+	chmod 600 src-20/sub/mode.txt
+	rm src-20/sub/removed.txt
+	printf 'added' > src-20/sub/added.txt
+	find src-20 -exec touch -t 202001010000 {} +
+	if ! arkiv-format create c.arkiv src-20 ||
+	   [ "$(arkiv-format diff a.arkiv c.arkiv)" != "$(printf '%s\n' \
+		'added    src-20/sub/added.txt' \
+		'content  src-20/sub/content.txt' \
+		'meta     src-20/sub/mode.txt (mode 0644 -> 0600)' \
+		'removed  src-20/sub/removed.txt')" ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./c.arkiv ./src-20
+		fail "[$TYPE] TEST 20: arkiv-format diff"
+	fi
+	# limited to a prefix
+	if [ "$(arkiv-format diff a.arkiv c.arkiv src-20/sub/mode.txt)" != 'meta     src-20/sub/mode.txt (mode 0644 -> 0600)' ] ||
+	   [ "$(arkiv-format diff a.arkiv c.arkiv src-20/same.txt)" != "" ]; then
+		rm -rf ./a.arkiv ./b.arkiv ./c.arkiv ./src-20
+		fail "[$TYPE] TEST 20: arkiv-format diff (prefix)"
+	fi
+	rm -rf ./a.arkiv ./b.arkiv ./c.arkiv ./src-20
+	success "[$TYPE] TEST 20"
+}
+
+# ########## TEST 21: CHECK ##########
+test21() {
+	TYPE="go"
+	mkdir -p src-21/sub res-21 || fail "[$TYPE] TEST 21: unable to create directories 'src-21' and 'res-21'"
+	printf 'same' > src-21/same.txt
+	printf 'escaped' > 'src-21/a\b"c'
+	printf 'old' > src-21/sub/content.txt
+	printf 'mode' > src-21/sub/mode.txt
+	printf 'gone' > src-21/sub/removed.txt
+	chmod 644 src-21/sub/mode.txt
+	find src-21 -exec touch -t 202001010000 {} +
+	# a restoration matches its archive
+	if ! arkiv-format create a.arkiv src-21 ||
+	   ! arkiv-format extract a.arkiv res-21 ||
+	   ! diff -r src-21 res-21/src-21 > /dev/null ||
+	   [ "$(arkiv-format check a.arkiv res-21)" != "" ]; then
+		rm -rf ./a.arkiv ./src-21 ./res-21
+		fail "[$TYPE] TEST 21: arkiv-format check (restoration)"
+	fi
+	printf 'new' > res-21/src-21/sub/content.txt
+	chmod 600 res-21/src-21/sub/mode.txt
+	rm res-21/src-21/sub/removed.txt
+	printf 'added' > res-21/src-21/sub/added.txt
+	find res-21 -exec touch -t 202001010000 {} +
+	if arkiv-format check a.arkiv res-21 > res-21.out 2> /dev/null ||
+	   [ "$(cat res-21.out)" != "$(printf '%s\n' \
+		'extra    src-21/sub/added.txt' \
+		'content  src-21/sub/content.txt' \
+		'meta     src-21/sub/mode.txt (mode 0644 -> 0600)' \
+		'missing  src-21/sub/removed.txt')" ]; then
+		rm -rf ./a.arkiv ./src-21 ./res-21 ./res-21.out
+		fail "[$TYPE] TEST 21: arkiv-format check"
+	fi
+	# an unreadable file is reported, and the check goes on (root reads
+	# everything)
+	if [ "$(id -u)" -ne 0 ]; then
+		chmod 000 res-21/src-21/same.txt
+		if arkiv-format check a.arkiv res-21 > res-21.out 2> /dev/null ||
+		   [ "$(grep -c '^unreadable src-21/same.txt' res-21.out)" != 1 ] ||
+		   [ "$(grep -c '^missing  src-21/sub/removed.txt$' res-21.out)" != 1 ]; then
+			chmod 644 res-21/src-21/same.txt
+			rm -rf ./a.arkiv ./src-21 ./res-21 ./res-21.out
+			fail "[$TYPE] TEST 21: arkiv-format check (unreadable file)"
+		fi
+		chmod 644 res-21/src-21/same.txt
+	fi
+	# limited to a prefix
+	if [ "$(arkiv-format check a.arkiv res-21 src-21/same.txt)" != "" ] ||
+	   arkiv-format check a.arkiv res-21 src-21/sub/mode.txt > /dev/null 2>&1; then
+		rm -rf ./a.arkiv ./src-21 ./res-21 ./res-21.out
+		fail "[$TYPE] TEST 21: arkiv-format check (prefix)"
+	fi
+	rm -rf ./a.arkiv ./src-21 ./res-21 ./res-21.out
+	success "[$TYPE] TEST 21"
+}
+
 # ########## SHELL ##########
 OLD_PATH=$PATH
 PATH=$(pwd)/../shell/:$OLD_PATH
@@ -173,6 +744,7 @@ test1 sh
 test2 sh
 test3 sh
 test4 sh
+test5 sh
 echo
 
 PATH=$(pwd)/../go/:$OLD_PATH
@@ -184,5 +756,22 @@ test1 go
 test2 go
 test3 go
 test4 go
+test5 go
+test6
+test7
+test8
+test9
+test10
+test11
+test12
+test13
+test14
+test15
+test16
+test17
+test18
+test19
+test20
+test21
 
 